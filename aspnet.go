@@ -0,0 +1,371 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// ErrNoPostBackForm is returned when the page has no form to post back.
+	ErrNoPostBackForm = errors.New("bot: page has no postback form")
+
+	// ErrNoScriptManager is returned by AsyncPostBack when the page has
+	// no ScriptManager, and thus can not make partial postbacks.
+	ErrNoScriptManager = errors.New("bot: page has no ScriptManager")
+)
+
+var (
+	// doPostBack matches __doPostBack('target', 'argument') calls.
+	doPostBack = regexp.MustCompile(`__doPostBack\(\s*(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)")\s*,\s*(?:'((?:[^'\\]|\\.)*)'|"((?:[^"\\]|\\.)*)")\s*\)`)
+
+	// postBackOptions matches new WebForm_PostBackOptions("target", "argument", ...)
+	// calls, used by controls with validation.
+	postBackOptions = regexp.MustCompile(`WebForm_PostBackOptions\(\s*"((?:[^"\\]|\\.)*)"\s*,\s*"((?:[^"\\]|\\.)*)"`)
+
+	// pageRequestManager matches the ScriptManager initialization,
+	// with the ScriptManager unique id, the form id and the UpdatePanels.
+	pageRequestManager = regexp.MustCompile(`PageRequestManager\._initialize\(\s*'([^']+)'\s*,\s*'([^']*)'\s*,\s*\[([^\]]*)\]`)
+
+	// quoted matches the single quoted strings in a JavaScript array.
+	quoted = regexp.MustCompile(`'([^']*)'`)
+
+	jsUnescaper = strings.NewReplacer(`\\`, `\`, `\'`, `'`, `\"`, `"`)
+)
+
+// ParsePostBack returns the target and argument of the __doPostBack
+// call in a javascript: href or event handler, such as
+// "javascript:__doPostBack('ctl00$Main$Grid','Page$2')".
+func ParsePostBack(js string) (target, argument string, ok bool) {
+	if strings.Contains(js, "%") {
+		if s, err := url.PathUnescape(js); err == nil {
+			js = s
+		}
+	}
+	if m := doPostBack.FindStringSubmatch(js); m != nil {
+		return jsUnescaper.Replace(m[1] + m[2]), jsUnescaper.Replace(m[3] + m[4]), true
+	}
+	if m := postBackOptions.FindStringSubmatch(js); m != nil {
+		return jsUnescaper.Replace(m[1]), jsUnescaper.Replace(m[2]), true
+	}
+	return "", "", false
+}
+
+// PostBackForm returns the ASP.NET WebForms main form of the page,
+// which is the one with the __VIEWSTATE field, or the first form.
+func (page *Page) PostBackForm() (*Form, error) {
+	form, _, err := page.postBackForm()
+	return form, err
+}
+
+// postBackForm returns the main form, and the parsed page document.
+func (page *Page) postBackForm() (*Form, *goquery.Document, error) {
+	forms, err := page.Forms()
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := page.document()
+	if err != nil {
+		return nil, nil, err
+	}
+	i := doc.Find("form").IndexOfSelection(mainForm(doc))
+	if i < 0 || i >= len(forms) {
+		return nil, nil, ErrNoPostBackForm
+	}
+	return &forms[i], doc, nil
+}
+
+// mainForm returns the form with the __VIEWSTATE field, or the first form.
+func mainForm(doc *goquery.Document) *goquery.Selection {
+	forms := doc.Find("form")
+	if f := forms.Has(`input[name="__VIEWSTATE"]`); f.Length() > 0 {
+		return f.First()
+	}
+	return forms.First()
+}
+
+// postBackValues returns the form fields sent in a postback, without
+// the submit buttons and the select options parsed by Page.Forms.
+func postBackValues(form *Form, doc *goquery.Document) url.Values {
+	values := make(url.Values)
+	for k, v := range form.Fields {
+		if !strings.HasSuffix(k, ":options") {
+			values[k] = append([]string(nil), v...)
+		}
+	}
+	mainForm(doc).Find("input").Each(func(i int, s *goquery.Selection) {
+		if strings.EqualFold(s.AttrOr("type", ""), "submit") {
+			values.Del(s.AttrOr("name", ""))
+		}
+	})
+	return values
+}
+
+// PostBack posts back the page as when the user clicks on the control
+// with the given id or name. The control can be a link or any element
+// that calls __doPostBack, or a submit button. The fields are sent in
+// addition to the main form fields, replacing their values.
+func (bot *Bot) PostBack(page *Page, control string, fields url.Values) (*Page, error) {
+	form, doc, err := page.postBackForm()
+	if err != nil {
+		return nil, err
+	}
+	el := doc.Find(`[id="` + control + `"], [name="` + control + `"]`).First()
+	if el.Length() == 0 {
+		return nil, fmt.Errorf("bot: control %q not found", control)
+	}
+	for _, attr := range []string{"href", "onclick", "onchange"} {
+		if target, argument, ok := ParsePostBack(el.AttrOr(attr, "")); ok {
+			return bot.DoPostBack(page, target, argument, fields)
+		}
+	}
+	name, typ := el.AttrOr("name", ""), strings.ToLower(el.AttrOr("type", "submit"))
+	if name == "" || !el.Is("button, input") || (typ != "submit" && typ != "image") {
+		return nil, fmt.Errorf("bot: control %q does not post back", control)
+	}
+	values := postBackValues(form, doc)
+	values.Set("__EVENTTARGET", "")
+	values.Set("__EVENTARGUMENT", "")
+	if typ == "image" {
+		values.Set(name+".x", "1")
+		values.Set(name+".y", "1")
+	} else {
+		values.Set(name, el.AttrOr("value", ""))
+	}
+	req, err := page.postBackRequest(bot.context(), form, values, fields)
+	if err != nil {
+		return nil, err
+	}
+	return bot.Do(req)
+}
+
+// DoPostBack posts back the page as the JavaScript call
+// __doPostBack(target, argument) does. The fields are sent in addition
+// to the main form fields, replacing their values.
+func (bot *Bot) DoPostBack(page *Page, target, argument string, fields url.Values) (*Page, error) {
+	req, err := page.doPostBackRequest(bot.context(), target, argument, fields)
+	if err != nil {
+		return nil, err
+	}
+	return bot.Do(req)
+}
+
+// AsyncPostBack makes a partial postback of the UpdatePanel that
+// contains the target, as __doPostBack(target, argument) does in pages
+// with a ScriptManager. The delta response is applied to the page,
+// and the updated page is returned. The original page is not changed.
+func (bot *Bot) AsyncPostBack(page *Page, target, argument string, fields url.Values) (*Page, error) {
+	form, doc, err := page.postBackForm()
+	if err != nil {
+		return nil, err
+	}
+	body, err := page.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	m := pageRequestManager.FindSubmatch(body)
+	if m == nil {
+		return nil, ErrNoScriptManager
+	}
+	values := postBackValues(form, doc)
+	values.Set("__EVENTTARGET", target)
+	values.Set("__EVENTARGUMENT", argument)
+	values.Set("__ASYNCPOST", "true")
+	values.Set(string(m[1]), updatePanel(doc, string(m[3]), target)+"|"+target)
+	req, err := page.postBackRequest(bot.context(), form, values, fields)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-MicrosoftAjax", "Delta=true")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	delta, err := bot.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return bot.applyDelta(page, delta)
+}
+
+// updatePanel returns the unique id of the UpdatePanel that contains
+// the target, or of the first UpdatePanel. The panels are listed in
+// the ScriptManager initialization, as pairs of unique and client ids
+// since .NET 4, or as unique ids only, prefixed by 't' or 'f'.
+func updatePanel(doc *goquery.Document, panels, target string) string {
+	var items []string
+	for _, m := range quoted.FindAllStringSubmatch(panels, -1) {
+		items = append(items, m[1])
+	}
+	step := 1
+	if len(items)%2 == 0 && len(items) > 0 && doc.Find(`[id="`+items[1]+`"]`).Length() > 0 {
+		step = 2
+	}
+	clientIDs := make(map[string]string)
+	first := ""
+	for i := 0; i < len(items); i += step {
+		if items[i] == "" {
+			continue
+		}
+		uniqueID := strings.TrimLeft(items[i][:1], "tf") + items[i][1:]
+		clientID := strings.ReplaceAll(uniqueID, "$", "_")
+		if step == 2 {
+			clientID = items[i+1]
+		}
+		clientIDs[clientID] = uniqueID
+		if first == "" {
+			first = uniqueID
+		}
+	}
+	el := doc.Find(`[name="` + target + `"], [id="` + strings.ReplaceAll(target, "$", "_") + `"]`).First()
+	for ; el.Length() > 0; el = el.Parent() {
+		if id, ok := clientIDs[el.AttrOr("id", "")]; ok {
+			return id
+		}
+	}
+	return first
+}
+
+// postBackRequest returns the request that submits the main form
+// with the values and fields, using the context ctx.
+func (page *Page) postBackRequest(ctx context.Context, form *Form, values, fields url.Values) (*http.Request, error) {
+	for k, v := range fields {
+		values[k] = v
+	}
+	f := *form
+	f.Method = "POST"
+	return page.formRequest(ctx, &f, values)
+}
+
+// doPostBackRequest returns the request made by __doPostBack(target, argument),
+// using the context ctx.
+func (page *Page) doPostBackRequest(ctx context.Context, target, argument string, fields url.Values) (*http.Request, error) {
+	form, doc, err := page.postBackForm()
+	if err != nil {
+		return nil, err
+	}
+	values := postBackValues(form, doc)
+	values.Set("__EVENTTARGET", target)
+	values.Set("__EVENTARGUMENT", argument)
+	return page.postBackRequest(ctx, form, values, fields)
+}
+
+// deltaNode is an update in a partial postback response.
+type deltaNode struct {
+	typ, id, content string
+}
+
+// parseDelta parses the partial postback response, a sequence of
+// length|type|id|content| updates, where the length is the number of
+// UTF-16 code units in the content.
+func parseDelta(s string) ([]deltaNode, error) {
+	u := utf16.Encode([]rune(s))
+	field := func() (string, error) {
+		for i, c := range u {
+			if c == '|' {
+				f := string(utf16.Decode(u[:i]))
+				u = u[i+1:]
+				return f, nil
+			}
+		}
+		return "", fmt.Errorf("bot: invalid partial postback response")
+	}
+	var nodes []deltaNode
+	for len(u) > 0 {
+		var node deltaNode
+		f, err := field()
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("bot: invalid partial postback response: %v", err)
+		}
+		if node.typ, err = field(); err != nil {
+			return nil, err
+		}
+		if node.id, err = field(); err != nil {
+			return nil, err
+		}
+		if n < 0 || len(u) < n+1 || u[n] != '|' {
+			return nil, fmt.Errorf("bot: invalid partial postback response")
+		}
+		node.content = string(utf16.Decode(u[:n]))
+		u = u[n+1:]
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// applyDelta applies the partial postback response to a copy of page.
+func (bot *Bot) applyDelta(page, delta *Page) (*Page, error) {
+	body, err := delta.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := parseDelta(string(body))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := page.document()
+	if err != nil {
+		return nil, err
+	}
+	form := mainForm(doc)
+	for _, node := range nodes {
+		switch node.typ {
+		case "updatePanel":
+			doc.Find(`[id="` + node.id + `"]`).SetHtml(node.content)
+		case "hiddenField":
+			if input := form.Find(`input[name="` + node.id + `"]`); input.Length() > 0 {
+				input.SetAttr("value", node.content)
+			} else {
+				form.AppendHtml(fmt.Sprintf(`<input type="hidden" name="%s" id="%s" value="%s">`,
+					html.EscapeString(node.id), html.EscapeString(node.id), html.EscapeString(node.content)))
+			}
+		case "formAction":
+			form.SetAttr("action", node.content)
+		case "pageTitle":
+			doc.Find("title").SetText(node.content)
+		case "pageRedirect":
+			target, err := url.PathUnescape(node.content)
+			if err != nil {
+				return nil, err
+			}
+			u, err := delta.URL().Parse(target)
+			if err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequestWithContext(bot.context(), "GET", u.String(), nil)
+			if err != nil {
+				return nil, err
+			}
+			return bot.Do(req)
+		case "error":
+			return nil, fmt.Errorf("bot: partial postback error %s: %s", node.id, node.content)
+		}
+	}
+	merged, err := doc.Html()
+	if err != nil {
+		return nil, err
+	}
+	resp := *delta.resp
+	resp.Header = resp.Header.Clone()
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	resp.ContentLength = int64(len(merged))
+	resp.Body = ioutil.NopCloser(bytes.NewReader([]byte(merged)))
+	updated := &Page{resp: &resp, body: []byte(merged), bot: bot}
+	bot.history.setLast(updated)
+	return updated, nil
+}
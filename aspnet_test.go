@@ -0,0 +1,152 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+const webFormsPage = `<html><head><title>Portal</title></head><body>
+<form method="post" action="./default.aspx?id=1" id="aspnetForm">
+<input type="hidden" name="__EVENTTARGET" id="__EVENTTARGET" value="">
+<input type="hidden" name="__EVENTARGUMENT" id="__EVENTARGUMENT" value="">
+<input type="hidden" name="__VIEWSTATE" id="__VIEWSTATE" value="vs1">
+<input type="hidden" name="__EVENTVALIDATION" id="__EVENTVALIDATION" value="ev1">
+<script type="text/javascript">
+Sys.WebForms.PageRequestManager._initialize('ctl00$ScriptManager1', 'aspnetForm', ['tctl00$Main$Panel','Main_Panel'], [], [], 90, 'ctl00');
+</script>
+<input type="text" name="ctl00$Main$Name" value="old">
+<a id="Main_Next" href="javascript:__doPostBack(&#39;ctl00$Main$Grid&#39;,&#39;Page$2&#39;)">Next</a>
+<input type="submit" name="ctl00$Main$Save" id="Main_Save" value="Save">
+<div id="Main_Panel"><a id="Main_Refresh" href="javascript:__doPostBack('ctl00$Main$Refresh','')">Refresh</a> Old</div>
+</form></body></html>`
+
+// delta renders a partial postback response.
+func delta(nodes ...[3]string) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		fmt.Fprintf(&b, "%d|%s|%s|%s|", len(utf16.Encode([]rune(n[2]))), n[0], n[1], n[2])
+	}
+	return b.String()
+}
+
+func TestParsePostBack(t *testing.T) {
+	for js, want := range map[string][2]string{
+		"javascript:__doPostBack('ctl00$Main$Grid','Page$2')": {"ctl00$Main$Grid", "Page$2"},
+		`__doPostBack("a\"b", "")`:                            {`a"b`, ""},
+		"javascript:__doPostBack(%27ctl00$Link%27,%27%27)":    {"ctl00$Link", ""},
+		`WebForm_DoPostBackWithOptions(new WebForm_PostBackOptions("ctl00$Btn", "", true, "", "", false, true))`: {"ctl00$Btn", ""},
+	} {
+		target, argument, ok := ParsePostBack(js)
+		if !ok || target != want[0] || argument != want[1] {
+			t.Errorf("ParsePostBack(%q) = %q, %q, %v, want %q", js, target, argument, ok, want)
+		}
+	}
+	if _, _, ok := ParsePostBack("/next.aspx"); ok {
+		t.Errorf("Unexpected postback in a regular link")
+	}
+}
+
+func TestPostBack(t *testing.T) {
+	s := bottest.NewSite().HandleFunc("/default.aspx", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-MicrosoftAjax") == "Delta=true" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, delta(
+				[3]string{"updatePanel", "Main_Panel", "Atualização | New"},
+				[3]string{"hiddenField", "__VIEWSTATE", "vs2"},
+				[3]string{"pageTitle", "", "Updated"},
+			))
+			return
+		}
+		fmt.Fprint(w, webFormsPage)
+	})
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	page, err := b.GET("/default.aspx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := page.PostBackForm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.ID != "aspnetForm" {
+		t.Errorf("Unexpected form: %v", form.Print())
+	}
+
+	if _, err := b.PostBack(page, "Main_Next", url.Values{"ctl00$Main$Name": {"new"}}); err != nil {
+		t.Fatal(err)
+	}
+	s.AssertSubmitted(t, "/default.aspx", url.Values{
+		"__EVENTTARGET":     {"ctl00$Main$Grid"},
+		"__EVENTARGUMENT":   {"Page$2"},
+		"__VIEWSTATE":       {"vs1"},
+		"__EVENTVALIDATION": {"ev1"},
+		"ctl00$Main$Name":   {"new"},
+		"ctl00$Main$Save":   nil,
+		"id":                {"1"},
+	})
+	s.AssertHeader(t, "/default.aspx", "Referer", s.URL+"/default.aspx")
+
+	if _, err := b.PostBack(page, "ctl00$Main$Save", nil); err != nil {
+		t.Fatal(err)
+	}
+	s.AssertSubmitted(t, "/default.aspx", url.Values{
+		"__EVENTTARGET":   {""},
+		"ctl00$Main$Save": {"Save"},
+		"ctl00$Main$Name": {"old"},
+	})
+
+	updated, err := b.AsyncPostBack(page, "ctl00$Main$Refresh", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AssertSubmitted(t, "/default.aspx", url.Values{
+		"ctl00$ScriptManager1": {"ctl00$Main$Panel|ctl00$Main$Refresh"},
+		"__ASYNCPOST":          {"true"},
+		"__EVENTTARGET":        {"ctl00$Main$Refresh"},
+	})
+	form, err = updated.PostBackForm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs := form.Fields.Get("__VIEWSTATE"); vs != "vs2" {
+		t.Errorf("Unexpected view state after partial postback: %q", vs)
+	}
+	doc, err := updated.document()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.Find("#Main_Panel").Text(); got != "Atualização | New" {
+		t.Errorf("Unexpected update panel: %q", got)
+	}
+	if got := doc.Find("title").Text(); got != "Updated" {
+		t.Errorf("Unexpected title: %q", got)
+	}
+
+	if _, err := b.PostBack(page, "missing", nil); err == nil {
+		t.Errorf("Expected an error posting back a missing control")
+	}
+}
+
+func TestParseDelta(t *testing.T) {
+	if _, err := parseDelta("5|updatePanel|p|abc|"); err == nil {
+		t.Errorf("Expected an error with an invalid length")
+	}
+	nodes, err := parseDelta(delta([3]string{"hiddenField", "a", "x|y"}, [3]string{"error", "500", "Fail"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].content != "x|y" || nodes[1].typ != "error" {
+		t.Errorf("Unexpected nodes: %v", nodes)
+	}
+}
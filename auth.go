@@ -0,0 +1,341 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// credentials are the user and password for a host,
+// with the authentication state cached from previous requests.
+type credentials struct {
+	user, pass string
+
+	mu     sync.Mutex
+	scheme string
+	digest *challenge
+	nc     int
+}
+
+// SetCredentials configures the user and password used to answer
+// HTTP authentication challenges from host. Basic, Digest and NTLMv2
+// schemes are supported. The host may include the port, and
+// credentials are never sent to other hosts, even after redirects.
+func (bot *Bot) SetCredentials(host, user, pass string) *Bot {
+	if bot.credentials == nil {
+		bot.credentials = make(map[string]*credentials)
+	}
+	bot.credentials[strings.ToLower(host)] = &credentials{user: user, pass: pass}
+	return bot
+}
+
+// credentialsFor returns the credentials for the host in u, if any.
+func (bot *Bot) credentialsFor(u *url.URL) *credentials {
+	if c, ok := bot.credentials[strings.ToLower(u.Host)]; ok {
+		return c
+	}
+	return bot.credentials[strings.ToLower(u.Hostname())]
+}
+
+// authenticate answers HTTP authentication challenges for hosts
+// configured with SetCredentials.
+func (bot *Bot) authenticate(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		creds := bot.credentialsFor(r.URL)
+		if creds == nil || r.Header.Get("Authorization") != "" {
+			return next.RoundTrip(r)
+		}
+		// Avoid leaking the Authorization header to the caller request.
+		r = r.Clone(r.Context())
+		if auth := creds.preemptive(r); auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		resp, err := next.RoundTrip(r)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+		for retries := 0; retries < 2; retries++ {
+			auth, err := creds.answer(r, parseChallenges(resp.Header["Www-Authenticate"]))
+			if auth == "" || err != nil {
+				return resp, err
+			}
+			retry, err := rewind(r)
+			if err != nil {
+				return resp, nil
+			}
+			drain(resp)
+			retry.Header.Set("Authorization", auth)
+			bot.retried(r, "auth")
+			if resp, err = next.RoundTrip(retry); err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+			r = retry
+		}
+		return resp, nil
+	})
+}
+
+// rewind returns a copy of r that can be sent again.
+func rewind(r *http.Request) (*http.Request, error) {
+	retry := r.Clone(r.Context())
+	if r.Body == nil || r.Body == http.NoBody {
+		return retry, nil
+	}
+	if r.GetBody == nil {
+		return nil, fmt.Errorf("bot: unable to resend request body for %v", r.URL)
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	retry.Body = body
+	return retry, nil
+}
+
+// drain reads and closes the response body, so the connection can
+// be reused by the next request.
+func drain(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+}
+
+// preemptive returns the Authorization header for r, based on the
+// cached state of a previous authentication.
+func (c *credentials) preemptive(r *http.Request) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.scheme {
+	case "basic":
+		return c.basic()
+	case "digest":
+		c.nc++
+		return c.digestAuth(r, c.digest, c.nc, newNonce())
+	}
+	return ""
+}
+
+// answer returns the Authorization header that answers the strongest
+// supported challenge, or an empty string if none is supported.
+func (c *credentials) answer(r *http.Request, challenges []challenge) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var basic, digest, ntlm *challenge
+	for i := range challenges {
+		ch := &challenges[i]
+		switch ch.scheme {
+		case "basic":
+			basic = ch
+		case "digest":
+			if algo := strings.ToUpper(ch.params["algorithm"]); digest == nil || strings.HasPrefix(algo, "SHA-256") {
+				if digestHash(algo) != nil {
+					digest = ch
+				}
+			}
+		case "ntlm":
+			ntlm = ch
+		}
+	}
+	switch {
+	case digest != nil:
+		if c.scheme == "digest" && c.digest != nil && c.digest.params["nonce"] == digest.params["nonce"] {
+			// The same nonce was rejected, so the password is wrong.
+			return "", nil
+		}
+		c.scheme, c.digest, c.nc = "digest", digest, 1
+		return c.digestAuth(r, digest, c.nc, newNonce()), nil
+	case ntlm != nil:
+		c.scheme = "ntlm"
+		if ntlm.token == "" {
+			return "NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiate()), nil
+		}
+		msg, err := base64.StdEncoding.DecodeString(ntlm.token)
+		if err != nil {
+			return "", fmt.Errorf("bot: invalid NTLM challenge: %v", err)
+		}
+		auth, err := ntlmAuthenticate(msg, c.user, c.pass)
+		if err != nil {
+			return "", err
+		}
+		return "NTLM " + base64.StdEncoding.EncodeToString(auth), nil
+	case basic != nil:
+		if c.scheme == "basic" && r.Header.Get("Authorization") != "" {
+			// Credentials were already sent and rejected.
+			return "", nil
+		}
+		c.scheme = "basic"
+		return c.basic(), nil
+	}
+	return "", nil
+}
+
+func (c *credentials) basic() string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.user+":"+c.pass))
+}
+
+// digestHash returns the hash function for the Digest algorithm,
+// or nil if the algorithm is not supported.
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+	return nil
+}
+
+// digestAuth computes the Digest Authorization header, as defined
+// in RFC 7616, for the request r.
+func (c *credentials) digestAuth(r *http.Request, ch *challenge, nc int, cnonce string) string {
+	algorithm := ch.params["algorithm"]
+	newHash := digestHash(algorithm)
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	realm, nonce, uri := ch.params["realm"], ch.params["nonce"], r.URL.RequestURI()
+	ha1 := h(c.user + ":" + realm + ":" + c.pass)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(r.Method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(ch.params["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	ncValue := fmt.Sprintf("%08x", nc)
+	var response string
+	if qop != "" {
+		response = h(strings.Join([]string{ha1, nonce, ncValue, cnonce, qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	}
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		c.user, realm, nonce, uri, response)
+	if algorithm != "" {
+		auth += ", algorithm=" + algorithm
+	}
+	if qop != "" {
+		auth += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, ncValue, cnonce)
+	}
+	if opaque, ok := ch.params["opaque"]; ok {
+		auth += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return auth
+}
+
+// newNonce returns a random client nonce.
+func newNonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// challenge is an authentication challenge from the WWW-Authenticate header.
+type challenge struct {
+	scheme string
+	token  string
+	params map[string]string
+}
+
+// token68Chars are the characters allowed in a token68, such as the
+// base64 encoded NTLM messages.
+const token68Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~+/="
+
+var token68 = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
+// parseChallenges parses the challenges in the WWW-Authenticate headers.
+// Scheme and parameter names are returned in lower case.
+func parseChallenges(headers []string) []challenge {
+	var result []challenge
+	for _, h := range headers {
+		s := strings.TrimLeft(h, " \t,")
+		for s != "" {
+			var scheme string
+			scheme, s = splitToken(s)
+			if scheme == "" {
+				// Malformed challenge: skip to the next one
+				if i := strings.IndexByte(s, ','); i >= 0 {
+					s = strings.TrimLeft(s[i+1:], " \t,")
+				} else {
+					s = ""
+				}
+				continue
+			}
+			ch := challenge{scheme: strings.ToLower(scheme), params: make(map[string]string)}
+			s = strings.TrimLeft(s, " \t")
+			word := s[:len(s)-len(strings.TrimLeft(s, token68Chars))]
+			if token68.MatchString(word) && !strings.HasPrefix(s[len(word):], `"`) {
+				ch.token, s = word, s[len(word):]
+			}
+			for {
+				s = strings.TrimLeft(s, " \t,")
+				name, after := splitToken(s)
+				after = strings.TrimLeft(after, " \t")
+				if name == "" || !strings.HasPrefix(after, "=") {
+					// Either the end of the header, or the next challenge
+					break
+				}
+				var value string
+				value, s = parseValue(strings.TrimLeft(after[1:], " \t"))
+				ch.params[strings.ToLower(name)] = value
+			}
+			result = append(result, ch)
+		}
+	}
+	return result
+}
+
+// splitToken returns the token at the start of s and the remaining string.
+func splitToken(s string) (string, string) {
+	i := strings.IndexAny(s, " \t,=")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// parseValue parses a token or quoted string at the start of s.
+func parseValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexAny(s, " \t,")
+		if i < 0 {
+			return s, ""
+		}
+		return s[:i], s[i:]
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestParseChallenges(t *testing.T) {
+	challenges := parseChallenges([]string{
+		`Digest realm="test, realm", qop="auth,auth-int", nonce=abc, Basic realm="x"`,
+		`NTLM TlRMTVNTUAACAAAA==`,
+		`Negotiate`,
+	})
+	if len(challenges) != 4 {
+		t.Fatalf("Expected 4 challenges, got %#v", challenges)
+	}
+	if c := challenges[0]; c.scheme != "digest" || c.params["realm"] != "test, realm" || c.params["nonce"] != "abc" || c.params["qop"] != "auth,auth-int" {
+		t.Errorf("Unexpected digest challenge: %#v", c)
+	}
+	if c := challenges[1]; c.scheme != "basic" || c.params["realm"] != "x" {
+		t.Errorf("Unexpected basic challenge: %#v", c)
+	}
+	if c := challenges[2]; c.scheme != "ntlm" || c.token != "TlRMTVNTUAACAAAA==" {
+		t.Errorf("Unexpected NTLM challenge: %#v", c)
+	}
+	if c := challenges[3]; c.scheme != "negotiate" || c.token != "" {
+		t.Errorf("Unexpected negotiate challenge: %#v", c)
+	}
+}
+
+func TestParseChallengesMalformed(t *testing.T) {
+	for _, h := range []string{`=x`, `Basic realm="a", =x`, `,=`, `Basic =, realm="b"`} {
+		done := make(chan []challenge)
+		go func() { done <- parseChallenges([]string{h}) }()
+		select {
+		case challenges := <-done:
+			for _, c := range challenges {
+				if c.scheme == "" {
+					t.Errorf("Unexpected challenge without scheme in %q: %#v", h, c)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("parseChallenges(%q) did not return", h)
+		}
+	}
+}
+
+func TestDigestResponse(t *testing.T) {
+	// Example from RFC 2617, section 3.5
+	c := &credentials{user: "Mufasa", pass: "Circle Of Life"}
+	ch := &challenge{params: map[string]string{
+		"realm": "testrealm@host.com",
+		"qop":   "auth,auth-int",
+		"nonce": "dcd98b7102dd2f0e8b11d0f600bfb0c093",
+	}}
+	r, _ := http.NewRequest("GET", "http://www.nowhere.org/dir/index.html", nil)
+	auth := c.digestAuth(r, ch, 1, "0a4f113b")
+	if !strings.Contains(auth, `response="6629fae49393a05397450978507c4ef1"`) {
+		t.Errorf("Unexpected digest response: %s", auth)
+	}
+}
+
+func TestNTLMv2(t *testing.T) {
+	// Test vectors from [MS-NLMP] section 4.2.4
+	key := ntowfv2("User", "Password", "Domain")
+	if got := hex.EncodeToString(key); got != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Errorf("Unexpected NTOWFv2: %s", got)
+	}
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge, _ := hex.DecodeString("aaaaaaaaaaaaaaaa")
+	targetInfo, _ := hex.DecodeString("02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000")
+	resp := ntlmv2Response(key, serverChallenge, clientChallenge, make([]byte, 8), targetInfo)
+	if got := hex.EncodeToString(resp[:16]); got != "68cd0ab851e51c96aabc927bebef6a1c" {
+		t.Errorf("Unexpected NTProofStr: %s", got)
+	}
+	if got := md4Sum([]byte("abc")); hex.EncodeToString(got[:]) != "a448017aaf21d8525fc10ae87aa6729d" {
+		t.Errorf("Unexpected MD4: %x", got)
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	other := bottest.NewSite().HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OTHER")
+	})
+	defer other.Close()
+
+	h := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	site := bottest.NewSite().
+		HandleFunc("/basic", func(w http.ResponseWriter, r *http.Request) {
+			if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "BASIC")
+		}).
+		HandleFunc("/digest", func(w http.ResponseWriter, r *http.Request) {
+			params := make(map[string]string)
+			for _, c := range parseChallenges([]string{r.Header.Get("Authorization")}) {
+				params = c.params
+			}
+			ha1 := h("admin:test:secret")
+			ha2 := h(r.Method + ":" + params["uri"])
+			expected := h(strings.Join([]string{ha1, "n0nc3", params["nc"], params["cnonce"], "auth", ha2}, ":"))
+			if params["response"] != expected {
+				w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", nonce="n0nc3", opaque="xyz"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "DIGEST")
+		}).
+		Redirect("/away", other.URL+"/", http.StatusFound)
+	defer site.Close()
+	u, _ := url.Parse(site.URL)
+
+	b := ReuseClient(&http.Client{}).SetCredentials(u.Host, "admin", "secret")
+	for _, path := range []string{"/basic", "/digest", "/digest"} {
+		page, err := b.POST(site.URL+path, url.Values{"a": {"1"}})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		checkBody(t, page, strings.ToUpper(path[1:]))
+	}
+	site.AssertSubmitted(t, "/digest", url.Values{"a": {"1"}})
+	if sub, _ := site.LastSubmission("/digest"); !strings.Contains(sub.Header.Get("Authorization"), "nc=00000002") {
+		t.Errorf("Expected cached digest state to be reused, got %s", sub.Header.Get("Authorization"))
+	}
+
+	if _, err := b.GET(site.URL + "/away"); err != nil {
+		t.Fatal(err)
+	}
+	other.AssertHeader(t, "/", "Authorization", "")
+
+	b = ReuseClient(&http.Client{}).SetCredentials(u.Host, "admin", "wrong")
+	if _, err := b.GET(site.URL + "/digest"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected 401 error with invalid credentials, got %v", err)
+	}
+}
@@ -4,49 +4,162 @@
 package bot
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	// ErrTooManyRedirects is returned when the bot reaches more than 10 redirects.
+	// ErrTooManyRedirects is returned when the bot reaches more redirects
+	// than allowed by the RedirectPolicy.
 	ErrTooManyRedirects = errors.New("bot: too many redirects")
 )
 
+// StatusError is returned when the response status code is not 2xx.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bot: non 2xx response code: %d: %s", e.StatusCode, e.Status)
+}
+
+// contextKey is the type of the request context keys used by the Bot.
+type contextKey int
+
+const (
+	sourceKey contextKey = iota
+	proxyKey
+	redirectKey
+	viaKey
+	statsKey
+	loginKey
+)
+
 // Bot implements a statefull HTTP client for interacting with websites.
 type Bot struct {
-	b     string
-	j     *cookiejar.Jar
-	c     *http.Client
-	debug bool
+	b        string
+	j        http.CookieJar
+	c        *http.Client
+	ua       string
+	profile  *Profile
+	headers  http.Header
+	hosts    map[string]http.Header
+	referer  bool
+	debug    bool
+	logger   *slog.Logger
+	metrics  Metrics
+	dump     *DumpConfig
+	har      *HARRecorder
+	cassette *Cassette
+	cache    *Cache
+
+	// ctx is the context of requests made by the Bot methods,
+	// set with WithContext.
+	ctx context.Context
+
+	// observer is notified of the calls to Do, set with ObserveCalls.
+	observer CallObserver
+
+	// credentials are the user and password for each host.
+	credentials map[string]*credentials
+
+	// proxy settings, configured with SetProxy, SetHostProxy
+	// and UseProxyPool.
+	proxy       string
+	hostProxies map[string]string
+	pool        *ProxyPool
+	proxied     bool
+
+	// redirect is the policy used to follow redirects.
+	redirect RedirectPolicy
+
+	// middlewares are the custom transport middlewares, added with Use.
+	middlewares []Middleware
+
+	// secrets holds the form field names to redact from dumps.
+	secrets *sync.Map
+
+	// csrf holds the anti-CSRF tokens, when enabled with UseCSRF.
+	csrf *csrfState
+
+	// session is the login and expiry detection configured with
+	// SetSession.
+	session *session
 
-	// lastURL records the last seen URL using the CheckRedirect function.
-	// TODO(ronoaldo): change to a history of recent URLs.
+	// history records the visited URLs, including redirects,
+	// and the last page returned.
 	history *History
 }
 
-// New initializes a new Bot with an in-memory cookie management.
-func New() *Bot {
-	return ReuseClient(http.DefaultClient)
+// Option configures a Bot created with New.
+// Options are applied in the order they are provided.
+type Option func(*Bot)
+
+// WithClient makes the Bot use a copy of the client c.
+// The client c itself is never modified, and the Bot uses its own
+// cookie jar unless WithJar is also provided.
+func WithClient(c *http.Client) Option {
+	return func(bot *Bot) {
+		cc := *c
+		cc.Jar = nil
+		bot.c = &cc
+	}
 }
 
-func ReuseClient(c *http.Client) *Bot {
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		// Currently, cookiejar.Nil never returns an error
-		panic(err)
+// WithJar makes the Bot use the cookie jar j, that can be shared
+// with other Bots or clients.
+func WithJar(j http.CookieJar) Option {
+	return func(bot *Bot) {
+		bot.j = j
+	}
+}
+
+// WithTimeout sets the time limit for requests made by the Bot,
+// as in http.Client.Timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(bot *Bot) {
+		bot.c.Timeout = d
 	}
-	c.Jar = jar
+}
+
+// New initializes a new Bot with an in-memory cookie management.
+// By default, the Bot uses its own http.Client, with the same
+// transport of http.DefaultClient, which is never modified.
+func New(opts ...Option) *Bot {
 	bot := &Bot{
-		j:       jar,
-		c:       c,
+		c:       &http.Client{},
 		history: &History{},
+		secrets: &sync.Map{},
+		referer: true,
+	}
+	for _, opt := range opts {
+		opt(bot)
+	}
+	if bot.j == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			// Currently, cookiejar.Nil never returns an error
+			panic(err)
+		}
+		bot.j = jar
+	}
+	// Record the cookies with their attributes, to save crawl sessions.
+	bot.j = newCookieRecorder(bot.j)
+	bot.c.Jar = bot.j
+	origTransport := bot.c.Transport
+	if t, ok := origTransport.(*transport); ok {
+		// Do not chain the transport of another Bot
+		origTransport = t.t
 	}
-	origTransport := c.Transport
 	if origTransport == nil {
 		origTransport = http.DefaultTransport
 	}
@@ -59,20 +172,98 @@ func ReuseClient(c *http.Client) *Bot {
 	return bot
 }
 
+// ReuseClient initializes a new Bot that uses a copy of the client c.
+// It is a shortcut for New(WithClient(c)).
+func ReuseClient(c *http.Client) *Bot {
+	return New(WithClient(c))
+}
+
 // Do sends the HTTP request using the http.Client.Do.
 // It returns a nil page if there is a network error.
 // It will also return an error if the response is not 2xx,
 // but the returned page is non-nil, and you can parse the error body.
+// Redirects that are not followed, according to the RedirectPolicy,
+// are returned as a Page without error. If the session configured with
+// SetSession expired, the Bot logs in and sends the request again.
+// Each call is reported to the CallObserver set with ObserveCalls.
 func (bot *Bot) Do(req *http.Request) (*Page, error) {
-	bot.history.Add(bot.b + req.URL.String())
+	return bot.observe(req)
+}
+
+// do sends the request, logging in again if the session expired.
+func (bot *Bot) do(req *http.Request) (*Page, error) {
+	s := bot.session
+	if req.Context().Value(loginKey) != nil {
+		// Requests sent by the login function are not retried.
+		s = nil
+	}
+	var (
+		gen   uint64
+		retry *http.Request
+	)
+	if s != nil {
+		gen = s.generation()
+		// Copy the request before the client adds the session cookies.
+		// The body is copied only if the request is sent again.
+		retry = req.Clone(req.Context())
+	}
+	page, err := bot.navigate(req)
+	if s != nil && page != nil && s.isExpired(page) {
+		bot.log().Info("session expired", "url", req.URL.String())
+		page.discard()
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("bot: unable to resend request body for %v after session expired", req.URL)
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			retry.Body = body
+		}
+		if err := s.relogin(bot, gen); err != nil {
+			return nil, fmt.Errorf("bot: unable to login after session expired: %w", err)
+		}
+		bot.retried(req, "session")
+		page, err = bot.navigate(retry)
+	}
+	if err != nil {
+		// The page of a status error is not returned, so release
+		// its connection.
+		page.discard()
+		return nil, err
+	}
+	if bot.csrf != nil {
+		bot.csrf.extract(page)
+	}
+	bot.history.setLast(page)
+	return page, nil
+}
+
+// navigate sends the request, and follows refresh redirects if enabled.
+// If the response is not 2xx, both the page and an error are returned.
+func (bot *Bot) navigate(req *http.Request) (*Page, error) {
+	bot.setReferer(req)
+	bot.history.Add(req.URL.String())
+	page, err := bot.send(req)
+	if err != nil {
+		return page, err
+	}
+	return bot.followRefresh(req, page)
+}
+
+// send sends the request, and returns the resulting Page.
+// If the response is not 2xx, both the page and an error are returned.
+func (bot *Bot) send(req *http.Request) (*Page, error) {
 	resp, err := bot.c.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, fmt.Errorf("bot: non 2xx response code: %d: %s", resp.StatusCode, resp.Status)
+	page := &Page{resp: resp, bot: bot}
+	if (resp.StatusCode < 200 || resp.StatusCode > 299) && !isRedirect(resp) {
+		return page, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
-	return &Page{resp: resp}, nil
+	return page, nil
 }
 
 // GET performs the HTTP GET to the provided URL and returns a Page.
@@ -80,15 +271,11 @@ func (bot *Bot) Do(req *http.Request) (*Page, error) {
 // It will also return an error if the response is not 2xx,
 // but the returned page is non-nil, and you can parse the error body.
 func (bot *Bot) GET(url string) (*Page, error) {
-	bot.history.Add(bot.b + url)
-	resp, err := bot.c.Get(bot.b + url)
+	req, err := http.NewRequestWithContext(bot.context(), "GET", bot.b+url, nil)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, fmt.Errorf("bot: non 2xx response code: %d: %s", resp.StatusCode, resp.Status)
-	}
-	return &Page{resp: resp}, nil
+	return bot.Do(req)
 }
 
 // POST performs an HTTP POST to the provided URL,
@@ -97,26 +284,48 @@ func (bot *Bot) GET(url string) (*Page, error) {
 // It will also return an error if the response is not 2xx,
 // but the returned page is non-nil, and you can parse the error body.
 func (bot *Bot) POST(url string, form url.Values) (*Page, error) {
-	bot.history.Add(bot.b + url)
-	resp, err := bot.c.PostForm(bot.b+url, form)
+	req, err := http.NewRequestWithContext(bot.context(), "POST", bot.b+url, strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, fmt.Errorf("bot: non 2xx response code: %d: %s", resp.StatusCode, resp.Status)
-	}
-	return &Page{resp: resp}, nil
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return bot.Do(req)
 }
 
-// Debug enables debugging messages to standard error stream.
+// Debug enables dumping requests and responses at the debug level.
+// If no logger was configured with SetLogger, the messages are written
+// to the standard error stream. Sensitive data is redacted from the
+// dumps, and the output can be customized with Dump.
 func (bot *Bot) Debug(enabled bool) *Bot {
 	bot.debug = enabled
 	return bot
 }
 
+// SetLogger configures the structured logger used by the Bot
+// to report requests, redirects, cookies and parse warnings.
+// By default, nothing is logged. Passing nil restores the default.
+func (bot *Bot) SetLogger(logger *slog.Logger) *Bot {
+	bot.logger = logger
+	return bot
+}
+
+// log returns the logger to be used by the Bot.
+func (bot *Bot) log() *slog.Logger {
+	switch {
+	case bot == nil:
+		return discardLogger
+	case bot.logger != nil:
+		return bot.logger
+	case bot.debug:
+		return debugLogger
+	}
+	return discardLogger
+}
+
 // SetUA allows one to change the default user agent used by the Bot.
+// It takes precedence over the user agent of the Profile in use.
 func (bot *Bot) SetUA(userAgent string) *Bot {
-	bot.c.Transport.(*transport).ua = userAgent
+	bot.ua = userAgent
 	return bot
 }
 
@@ -130,12 +339,3 @@ func (bot *Bot) BaseURL(baseURL string) *Bot {
 func (bot *Bot) History() *History {
 	return bot.history
 }
-
-func (bot *Bot) checkRedirect(req *http.Request, via []*http.Request) error {
-	log.Printf("Redirecting to: %v (via %v)", req, via)
-	bot.history.Add(req.URL.String())
-	if len(via) > 10 {
-		return ErrTooManyRedirects
-	}
-	return nil
-}
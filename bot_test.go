@@ -4,15 +4,15 @@
 package bot
 
 import (
-	"fmt"
-	"log"
+	"bytes"
+	"log/slog"
 	"net/http"
-	"net/http/httptest"
 	"net/url"
-	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"ronoaldo.gopkg.net/bot/bottest"
 )
 
 func TestBotCookieJar(t *testing.T) {
@@ -21,7 +21,7 @@ func TestBotCookieJar(t *testing.T) {
 		page *Page
 		err  error
 	)
-	s := httptest.NewServer(&TestServer{})
+	s := newTestSite()
 	defer s.Close()
 
 	bot := New()
@@ -57,6 +57,62 @@ func TestBotCookieJar(t *testing.T) {
 	checkBody(t, page, "PRIVATE")
 }
 
+func TestBotLogger(t *testing.T) {
+	s := newTestSite()
+	defer s.Close()
+
+	var buff bytes.Buffer
+	bot := New().SetLogger(slog.New(slog.NewJSONHandler(&buff, nil)))
+	if _, err := bot.GET(s.URL + "/redirect/"); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{`"msg":"redirect"`, `"msg":"request end"`, `"status":200`} {
+		if !strings.Contains(buff.String(), msg) {
+			t.Errorf("Expected %s in log output, got:\n%s", msg, buff.String())
+		}
+	}
+	if strings.Contains(buff.String(), `"msg":"request start"`) {
+		t.Errorf("Unexpected debug message with info level logger:\n%s", buff.String())
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	s := newTestSite()
+	defer s.Close()
+
+	c := &http.Client{}
+	b1 := New()
+	b2 := New(WithClient(c), WithTimeout(time.Second))
+	if http.DefaultClient.Jar != nil || http.DefaultClient.Transport != nil || http.DefaultClient.CheckRedirect != nil {
+		t.Errorf("New should not modify http.DefaultClient: %#v", http.DefaultClient)
+	}
+	if c.Jar != nil || c.Transport != nil || c.Timeout != 0 {
+		t.Errorf("WithClient should not modify the client: %#v", c)
+	}
+	if b2.c.Timeout != time.Second {
+		t.Errorf("Unexpected client timeout: %v", b2.c.Timeout)
+	}
+
+	// Each Bot has its own session
+	if _, err := b1.POST(s.URL+"/login/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b2.GET(s.URL + "/private/"); err == nil {
+		t.Errorf("Expected b2 to not share the session with b1")
+	}
+
+	// Unless they share the same cookie jar
+	b3 := New(WithJar(b1.j), WithClient(b2.c))
+	if _, ok := b3.c.Transport.(*transport).t.(*transport); ok {
+		t.Errorf("Bot transport should not wrap another Bot transport")
+	}
+	page, err := b3.GET(s.URL + "/private/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "PRIVATE")
+}
+
 func checkStatus(t *testing.T, when string, resp *http.Response, expected int) {
 	if resp == nil {
 		t.Errorf("Response is nil")
@@ -78,38 +134,10 @@ func checkBody(t *testing.T, page *Page, expected string) {
 	}
 }
 
-// TestServer implements an http.Hander that handle /login/ and /private/
-type TestServer struct {
-	session string
-}
-
-func (t *TestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/login/":
-		t.session = strconv.FormatInt(time.Now().Unix(), 16)
-		http.SetCookie(w, &http.Cookie{
-			Name:  "TSID",
-			Value: t.session,
-			Path:  "/",
-		})
-		fmt.Fprintf(w, "OK")
-	case "/private/":
-		var (
-			c   *http.Cookie
-			err error
-		)
-		if c, err = r.Cookie("TSID"); err != nil {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		if t.session != c.Value {
-			log.Printf("E: Invalid session value %s -> expected %s", c.Value, t.session)
-			// User is not logged in
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		fmt.Fprintf(w, "PRIVATE")
-	default:
-		http.Error(w, "Not found", http.StatusNotFound)
-	}
+// newTestSite returns a fake site that handle /login/, /private/ and /redirect/.
+func newTestSite() *bottest.Site {
+	return bottest.NewSite().
+		Login("/login/", nil).
+		Private("/private/", "PRIVATE").
+		Redirect("/redirect/", "/login/", http.StatusFound)
 }
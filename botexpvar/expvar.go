@@ -0,0 +1,85 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+// Package botexpvar publishes the metrics of a Bot with the expvar package.
+//
+// The expvar package registers the /debug/vars handler in the
+// http.DefaultServeMux when imported, so it is kept out of the bot
+// package, and only programs that import this package serve it.
+//
+//	m, err := botexpvar.New("bot")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	b := bot.New().SetMetrics(m)
+package botexpvar
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ronoaldo.gopkg.net/bot"
+)
+
+// Metrics publishes the measurements of a Bot in an expvar map.
+// Counters are published by name and labels, and histograms as their
+// count and sum, such as
+// bot_request_duration_seconds_sum{host="example.com",method="GET"}.
+type Metrics struct {
+	m *expvar.Map
+}
+
+// mu serializes the creation of expvar maps.
+var mu sync.Mutex
+
+// New publishes the metrics in the expvar map with the given name,
+// such as "bot". The map is reused if it already exists, so Bots with
+// the same name share their metrics. An error is returned if the name
+// is already published, and is not a map.
+func New(name string) (*Metrics, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	v := expvar.Get(name)
+	if v == nil {
+		return &Metrics{m: expvar.NewMap(name)}, nil
+	}
+	m, ok := v.(*expvar.Map)
+	if !ok {
+		return nil, fmt.Errorf("botexpvar: %q is already published, and is not a map", name)
+	}
+	return &Metrics{m: m}, nil
+}
+
+// Add implements bot.Metrics.
+func (e *Metrics) Add(name string, labels bot.Labels, delta float64) {
+	e.m.AddFloat(name+labelKey(labels), delta)
+}
+
+// Observe implements bot.Metrics.
+func (e *Metrics) Observe(name string, labels bot.Labels, value float64) {
+	key := labelKey(labels)
+	e.m.AddFloat(name+"_count"+key, 1)
+	e.m.AddFloat(name+"_sum"+key, value)
+}
+
+// labelKey returns the labels sorted by name, in the Prometheus
+// text format, such as {host="example.com",method="GET"}.
+func labelKey(labels bot.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package botexpvar
+
+import (
+	"expvar"
+	"strings"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot"
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestMetrics(t *testing.T) {
+	s := bottest.NewSite().Page("/", "OK")
+	defer s.Close()
+
+	m, err := New("bot_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m2, err := New("bot_test"); err != nil || m2.m != m.m {
+		t.Errorf("Expected the expvar map to be reused, got %v", err)
+	}
+	b := bot.New().BaseURL(s.URL).SetMetrics(m)
+	for i := 0; i < 2; i++ {
+		if _, err := b.GET("/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	host := strings.TrimPrefix(s.URL, "http://")
+	vars := expvar.Get("bot_test").(*expvar.Map)
+	if v := vars.Get(`bot_requests_total{host="` + host + `",method="GET",status="200"}`); v == nil || v.String() != "2" {
+		t.Errorf("Unexpected request count: %v", v)
+	}
+	if v := vars.Get(`bot_request_duration_seconds_count{host="` + host + `",method="GET"}`); v == nil || v.String() != "2" {
+		t.Errorf("Unexpected duration count: %v", v)
+	}
+}
+
+func TestNewNotMap(t *testing.T) {
+	expvar.NewInt("bot_test_int")
+	if _, err := New("bot_test_int"); err == nil {
+		t.Errorf("Expected an error for a published var that is not a map")
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+/*
+Package bottest provides an in-process fake website to test Bot automations.
+
+A Site is built from routes that mimic what legacy websites usually have:
+pages with forms and tables, login pages that issue session cookies,
+redirects, pages encoded with different charsets and error pages.
+Every request received is recorded, so tests can assert what was submitted.
+
+	site := bottest.NewSite().
+		Login("/login", url.Values{"user": {"admin"}, "pass": {"secret"}}).
+		Private("/account", "<h1>Welcome</h1>")
+	defer site.Close()
+
+	b := bot.New()
+	b.POST(site.URL+"/login", url.Values{"user": {"admin"}, "pass": {"secret"}})
+	site.AssertSubmitted(t, "/login", url.Values{"user": {"admin"}})
+
+This package does not depend on the bot package, and can be used to test
+any HTTP client.
+*/
+package bottest
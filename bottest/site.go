@@ -0,0 +1,312 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bottest
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SessionCookie is the name of the cookie issued by Login routes.
+const SessionCookie = "BOTTESTSID"
+
+// Field is an input element rendered by a Form route.
+type Field struct {
+	Type  string
+	Name  string
+	Value string
+}
+
+// Submission is a request received by the Site.
+type Submission struct {
+	Method  string
+	Path    string
+	Query   url.Values
+	Form    url.Values
+	Header  http.Header
+	Cookies []*http.Cookie
+}
+
+// Site is a fake website, served in-process with an httptest.Server.
+// Routes can be added at any time, and are safe to be used by
+// concurrent requests.
+type Site struct {
+	*httptest.Server
+
+	mux *http.ServeMux
+
+	mu          sync.Mutex
+	submissions []Submission
+	sessions    map[string]bool
+}
+
+// NewSite starts a new Site with no routes.
+// The caller should call Close when finished, to shut it down.
+func NewSite() *Site {
+	s := &Site{
+		mux:      http.NewServeMux(),
+		sessions: make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// serveHTTP records the request before dispatching it to the routes.
+func (s *Site) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	sub := Submission{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   r.URL.Query(),
+		Form:    make(url.Values),
+		Header:  r.Header.Clone(),
+		Cookies: r.Cookies(),
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		sub.Form, _ = url.ParseQuery(string(body))
+	}
+	s.mu.Lock()
+	s.submissions = append(s.submissions, sub)
+	s.mu.Unlock()
+	s.mux.ServeHTTP(w, r)
+}
+
+// Handle registers a custom handler for the path.
+func (s *Site) Handle(path string, h http.Handler) *Site {
+	s.mux.Handle(path, h)
+	return s
+}
+
+// HandleFunc registers a custom handler function for the path.
+func (s *Site) HandleFunc(path string, h func(http.ResponseWriter, *http.Request)) *Site {
+	s.mux.HandleFunc(path, h)
+	return s
+}
+
+// Page serves the HTML document at path.
+func (s *Site) Page(path, doc string) *Site {
+	return s.Charset(path, "utf-8", doc)
+}
+
+// Charset serves the HTML document at path, encoded with the charset.
+// Supported charsets are utf-8 and iso-8859-1. For other charsets,
+// the document is served as is.
+func (s *Site) Charset(path, charset, doc string) *Site {
+	body := []byte(doc)
+	if strings.EqualFold(charset, "iso-8859-1") || strings.EqualFold(charset, "latin1") {
+		body = body[:0:0]
+		for _, r := range doc {
+			if r > 0xff {
+				r = '?'
+			}
+			body = append(body, byte(r))
+		}
+	}
+	return s.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset="+charset)
+		w.Write(body)
+	})
+}
+
+// Form serves a page with a single form, with the provided action
+// and input fields, that is submitted with the POST method.
+func (s *Site) Form(path, action string, fields ...Field) *Site {
+	return s.Page(path, RenderForm(action, fields...))
+}
+
+// Table serves a page with a single table, with the header and rows.
+func (s *Site) Table(path string, header []string, rows ...[]string) *Site {
+	return s.Page(path, RenderTable(header, rows...))
+}
+
+// Redirect redirects requests to path to the target URL,
+// using the HTTP status code.
+func (s *Site) Redirect(path, target string, code int) *Site {
+	return s.Handle(path, http.RedirectHandler(target, code))
+}
+
+// Error serves the HTML document at path, with the HTTP status code.
+func (s *Site) Error(path string, code int, doc string) *Site {
+	return s.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		fmt.Fprint(w, doc)
+	})
+}
+
+// Login serves a login page at path. A GET request renders a form
+// with the credential names as fields, and a POST request that submits
+// all the credentials values receives a new session cookie and the
+// body "OK". If credentials is empty, any POST request is accepted.
+// Invalid credentials are answered with 403 Forbidden.
+func (s *Site) Login(path string, credentials url.Values) *Site {
+	return s.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			names := make([]string, 0, len(credentials))
+			for name := range credentials {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			var fields []Field
+			for _, name := range names {
+				t := "text"
+				if strings.Contains(strings.ToLower(name), "pass") {
+					t = "password"
+				}
+				fields = append(fields, Field{Type: t, Name: name})
+			}
+			fmt.Fprint(w, RenderForm(path, fields...))
+			return
+		}
+		r.ParseForm()
+		for name := range credentials {
+			if r.PostForm.Get(name) != credentials.Get(name) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		sid := strconv.FormatInt(time.Now().UnixNano(), 16)
+		s.mu.Lock()
+		s.sessions[sid] = true
+		s.mu.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: sid, Path: "/"})
+		fmt.Fprint(w, "OK")
+	})
+}
+
+// Private serves the HTML document at path only for requests with a
+// session cookie issued by a Login route. Other requests are
+// answered with 403 Forbidden.
+func (s *Site) Private(path, doc string) *Site {
+	return s.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if !s.LoggedIn(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, doc)
+	})
+}
+
+// LoggedIn returns true if the request has a valid session cookie.
+func (s *Site) LoggedIn(r *http.Request) bool {
+	c, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[c.Value]
+}
+
+// Logout invalidates all sessions issued so far.
+func (s *Site) Logout() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]bool)
+}
+
+// Submissions returns all requests received so far.
+func (s *Site) Submissions() []Submission {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Submission, len(s.submissions))
+	copy(result, s.submissions)
+	return result
+}
+
+// LastSubmission returns the most recent request received for path.
+func (s *Site) LastSubmission(path string) (Submission, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.submissions) - 1; i >= 0; i-- {
+		if s.submissions[i].Path == path {
+			return s.submissions[i], true
+		}
+	}
+	return Submission{}, false
+}
+
+// AssertSubmitted reports a test error unless the most recent request
+// to path submitted all the values in want, as a form or query string.
+func (s *Site) AssertSubmitted(t testing.TB, path string, want url.Values) {
+	t.Helper()
+	sub, ok := s.LastSubmission(path)
+	if !ok {
+		t.Errorf("bottest: no request received for %s", path)
+		return
+	}
+	for name, values := range want {
+		got := sub.Form[name]
+		if got == nil {
+			got = sub.Query[name]
+		}
+		if strings.Join(got, ",") != strings.Join(values, ",") {
+			t.Errorf("bottest: %s %s: field %s = %q, expected %q", sub.Method, path, name, got, values)
+		}
+	}
+}
+
+// AssertHeader reports a test error unless the most recent request
+// to path had the header with the expected value.
+func (s *Site) AssertHeader(t testing.TB, path, header, want string) {
+	t.Helper()
+	sub, ok := s.LastSubmission(path)
+	if !ok {
+		t.Errorf("bottest: no request received for %s", path)
+		return
+	}
+	if got := sub.Header.Get(header); got != want {
+		t.Errorf("bottest: %s %s: header %s = %q, expected %q", sub.Method, path, header, got, want)
+	}
+}
+
+// RenderForm returns an HTML document with a single form.
+func RenderForm(action string, fields ...Field) string {
+	var buff bytes.Buffer
+	fmt.Fprintf(&buff, "<html><body>\n<form method=\"post\" action=\"%s\">\n", html.EscapeString(action))
+	for _, f := range fields {
+		t := f.Type
+		if t == "" {
+			t = "text"
+		}
+		fmt.Fprintf(&buff, "\t<input type=\"%s\" name=\"%s\" value=\"%s\">\n",
+			html.EscapeString(t), html.EscapeString(f.Name), html.EscapeString(f.Value))
+	}
+	fmt.Fprintf(&buff, "\t<input type=\"submit\" value=\"Submit\">\n</form>\n</body></html>\n")
+	return buff.String()
+}
+
+// RenderTable returns an HTML document with a single table.
+func RenderTable(header []string, rows ...[]string) string {
+	var buff bytes.Buffer
+	fmt.Fprintf(&buff, "<html><body>\n<table>\n")
+	if len(header) > 0 {
+		fmt.Fprintf(&buff, "\t<tr>")
+		for _, h := range header {
+			fmt.Fprintf(&buff, "<th>%s</th>", html.EscapeString(h))
+		}
+		fmt.Fprintf(&buff, "</tr>\n")
+	}
+	for _, row := range rows {
+		fmt.Fprintf(&buff, "\t<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(&buff, "<td>%s</td>", html.EscapeString(cell))
+		}
+		fmt.Fprintf(&buff, "</tr>\n")
+	}
+	fmt.Fprintf(&buff, "</table>\n</body></html>\n")
+	return buff.String()
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bottest
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"testing"
+)
+
+func TestSiteLogin(t *testing.T) {
+	site := NewSite().
+		Login("/login", url.Values{"user": {"admin"}, "password": {"secret"}}).
+		Private("/private", "PRIVATE")
+	defer site.Close()
+
+	jar, _ := cookiejar.New(nil)
+	c := &http.Client{Jar: jar}
+	resp, err := c.PostForm(site.URL+"/login", url.Values{"user": {"admin"}, "password": {"wrong"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for invalid credentials, got %d", resp.StatusCode)
+	}
+	resp, err = c.PostForm(site.URL+"/login", url.Values{"user": {"admin"}, "password": {"secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	site.AssertSubmitted(t, "/login", url.Values{"user": {"admin"}, "password": {"secret"}})
+
+	if resp, err = c.Get(site.URL + "/private"); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 after login, got %d", resp.StatusCode)
+	}
+	site.Logout()
+	if resp, err = c.Get(site.URL + "/private"); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 after logout, got %d", resp.StatusCode)
+	}
+	if n := len(site.Submissions()); n != 4 {
+		t.Errorf("Expected 4 submissions, got %d", n)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+// Package bottrace records the calls and requests of a Bot as
+// OpenTelemetry spans, and propagates the trace context to the sites.
+//
+// Each call to Bot.Do, and to the methods that use it, such as GET and
+// POST, records a span named after the request method, with the URL,
+// and the number of redirects and retries. Each request sent, including
+// redirects and retries after a login, is recorded as a client span
+// nested in it:
+//
+//	t := bottrace.New(tp, bottrace.WithPropagator(propagation.TraceContext{}))
+//	b := t.Install(bot.New())
+//
+// The span of a call is a child of the span in the request context, or
+// in the context set with Bot.WithContext.
+package bottrace
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"ronoaldo.gopkg.net/bot"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used by the Tracer.
+const TracerName = "ronoaldo.gopkg.net/bot"
+
+// Tracer records the calls and requests of Bots.
+type Tracer struct {
+	tracer trace.Tracer
+	prop   propagation.TextMapPropagator
+}
+
+// Option configures a Tracer.
+type Option func(*Tracer)
+
+// WithPropagator makes the Tracer send the trace context in the request
+// headers, using the propagator p, such as propagation.TraceContext{}.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(t *Tracer) {
+		t.prop = p
+	}
+}
+
+// New returns a Tracer that records spans with the provider tp.
+// If tp is nil, no spans are recorded, and the Tracer only propagates
+// the trace context, if configured with WithPropagator.
+func New(tp trace.TracerProvider, opts ...Option) *Tracer {
+	t := &Tracer{}
+	if tp != nil {
+		t.tracer = tp.Tracer(TracerName)
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Install enables tracing in the Bot b, and returns it.
+// It is a shortcut for b.ObserveCalls(t.ObserveCall).Use(t.Middleware).
+func (t *Tracer) Install(b *bot.Bot) *bot.Bot {
+	return b.ObserveCalls(t.ObserveCall).Use(t.Middleware)
+}
+
+// ObserveCall is a bot.CallObserver that records a span for each call.
+func (t *Tracer) ObserveCall(ctx context.Context, req *http.Request) (*http.Request, func(*bot.Call)) {
+	if t.tracer == nil {
+		return req, func(*bot.Call) {}
+	}
+	parent := req.Context()
+	if !trace.SpanContextFromContext(parent).IsValid() {
+		parent = ctx
+	}
+	// The span is named after the method only, as HTTP client spans,
+	// so span names have a low cardinality. The URL is an attribute.
+	_, span := t.tracer.Start(parent, req.Method,
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.Redacted()),
+		))
+	if req.ContentLength > 0 {
+		span.SetAttributes(attribute.Int64("http.request.body.size", req.ContentLength))
+	}
+	req = req.WithContext(trace.ContextWithSpan(req.Context(), span))
+	return req, func(call *bot.Call) {
+		defer span.End()
+		span.SetAttributes(
+			attribute.Int("bot.redirects", call.Redirects),
+			attribute.Int("bot.retries", call.Retries),
+		)
+		if call.StatusCode != 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", call.StatusCode))
+		}
+		if call.URL != nil && call.URL.String() != req.URL.String() {
+			span.SetAttributes(attribute.String("bot.final_url", call.URL.Redacted()))
+		}
+		if call.ContentLength >= 0 {
+			span.SetAttributes(attribute.Int64("http.response.body.size", call.ContentLength))
+		}
+		if call.Err != nil {
+			span.RecordError(call.Err)
+			span.SetStatus(codes.Error, call.Err.Error())
+		}
+	}
+}
+
+// Middleware is a bot.Middleware that records a client span for each
+// request sent, and propagates the trace context in the request headers.
+// Like other middlewares added with Bot.Use, it also records requests
+// served from the Bot cache, and the authentication retries are part of
+// the span of the original request.
+func (t *Tracer) Middleware(next http.RoundTripper) http.RoundTripper {
+	return bot.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if t.tracer == nil && t.prop == nil {
+			return next.RoundTrip(r)
+		}
+		ctx := r.Context()
+		var span trace.Span
+		if t.tracer != nil {
+			ctx, span = t.tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.full", r.URL.Redacted()),
+					attribute.String("server.address", r.URL.Hostname()),
+				))
+			defer span.End()
+		}
+		r = r.Clone(ctx)
+		if t.prop != nil {
+			t.prop.Inject(ctx, propagation.HeaderCarrier(r.Header))
+		}
+		resp, err := next.RoundTrip(r)
+		if span == nil {
+			return resp, err
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return resp, err
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.ContentLength >= 0 {
+			span.SetAttributes(attribute.Int64("http.response.body.size", resp.ContentLength))
+		}
+		if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+		return resp, nil
+	})
+}
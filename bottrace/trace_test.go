@@ -0,0 +1,137 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bottrace
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"ronoaldo.gopkg.net/bot"
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+// spanAttr returns the value of the span attribute, or an empty string.
+func spanAttr(span sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracing(t *testing.T) {
+	s := bottest.NewSite().
+		Redirect("/old/", "/page/", http.StatusFound).
+		Page("/page/", "PAGE").
+		Login("/login/", nil).
+		Private("/private/", "PRIVATE")
+	defer s.Close()
+
+	var out bytes.Buffer
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithSpanProcessor(recorder))
+	defer tp.Shutdown(context.Background())
+
+	b := New(tp, WithPropagator(propagation.TraceContext{})).Install(bot.New()).
+		BaseURL(s.URL).
+		SetSession(func(b *bot.Bot) error {
+			_, err := b.POST("/login/", url.Values{})
+			return err
+		}, bot.ExpiredOnStatus(http.StatusForbidden))
+
+	ctx, workflow := tp.Tracer("test").Start(context.Background(), "workflow")
+	page, err := b.WithContext(ctx).GET("/old/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := page.Bytes(); string(b) != "PAGE" {
+		t.Errorf("Unexpected body: %q", b)
+	}
+	if _, err := b.WithContext(ctx).GET("/private/"); err != nil {
+		t.Fatal(err)
+	}
+	workflow.End()
+
+	sub, _ := s.LastSubmission("/page/")
+	if tp := sub.Header.Get("Traceparent"); !strings.Contains(tp, workflow.SpanContext().TraceID().String()) {
+		t.Errorf("Expected the trace context to be propagated, got %q", tp)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	var clients []string
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindClient {
+			clients = append(clients, span.Name()+" "+spanAttr(span, "http.response.status_code"))
+			continue
+		}
+		// Spans are named after the method, so add the path.
+		key := span.Name()
+		if u, err := url.Parse(spanAttr(span, "url.full")); err == nil && u.Path != "" {
+			key += " " + u.Path
+		}
+		spans[key] = span
+	}
+	get := spans["GET /old/"]
+	if get == nil {
+		t.Fatalf("Expected a span for GET /old/, got %v", spans)
+	}
+	if get.Parent().SpanID() != workflow.SpanContext().SpanID() {
+		t.Errorf("Expected the span to be a child of the workflow span")
+	}
+	for key, want := range map[string]string{
+		"http.request.method":       "GET",
+		"url.full":                  s.URL + "/old/",
+		"http.response.status_code": "200",
+		"bot.redirects":             "1",
+		"bot.retries":               "0",
+		"bot.final_url":             s.URL + "/page/",
+	} {
+		if got := spanAttr(get, key); got != want {
+			t.Errorf("Unexpected attribute %s = %q, want %q", key, got, want)
+		}
+	}
+	private := spans["GET /private/"]
+	if private == nil || spanAttr(private, "bot.retries") != "1" {
+		t.Errorf("Expected a span for GET /private/ with 1 retry, got %v", private)
+	}
+	if login := spans["POST /login/"]; login == nil || login.Parent().SpanID() != workflow.SpanContext().SpanID() {
+		t.Errorf("Expected a span for the login, nested in the workflow span")
+	}
+	want := "GET 302,GET 200,GET 403,POST 200,GET 200"
+	if got := strings.Join(clients, ","); got != want {
+		t.Errorf("Unexpected client spans:\n%s, want\n%s", got, want)
+	}
+	for _, name := range []string{`"Name":"GET"`, `"Name":"workflow"`} {
+		if !strings.Contains(out.String(), name) {
+			t.Errorf("Expected the stdout exporter to write %s", name)
+		}
+	}
+
+	// Errors are recorded.
+	recorder.Reset()
+	if _, err := b.GET("/missing/"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	ended := recorder.Ended()
+	last := ended[len(ended)-1]
+	if last.Status().Code.String() != "Error" || spanAttr(last, "http.response.status_code") != "404" {
+		t.Errorf("Unexpected span for the error: %v %s", last.Status(), fmt.Sprint(last.Attributes()))
+	}
+}
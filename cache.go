@@ -0,0 +1,514 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned by a CacheStore when the key is not found.
+var ErrCacheMiss = errors.New("bot: cache miss")
+
+// cacheHeader marks the responses served from the cache.
+const cacheHeader = "X-From-Cache"
+
+// CacheStore stores the cached responses, by key.
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the value of the key, or ErrCacheMiss.
+	Get(key string) ([]byte, error)
+
+	// Set stores the value of the key.
+	Set(key string, value []byte) error
+
+	// Delete removes the key. Deleting a missing key is not an error.
+	Delete(key string) error
+}
+
+// MemoryCache is a CacheStore that keeps values in memory.
+type MemoryCache struct {
+	mu sync.Mutex
+	m  map[string][]byte
+}
+
+// NewMemoryCache returns an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{m: make(map[string][]byte)}
+}
+
+// Get implements CacheStore.
+func (c *MemoryCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.m[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return v, nil
+}
+
+// Set implements CacheStore.
+func (c *MemoryCache) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key] = value
+	return nil
+}
+
+// Delete implements CacheStore.
+func (c *MemoryCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.m, key)
+	return nil
+}
+
+// DiskCache is a CacheStore that keeps each value in a file in Dir,
+// named after the SHA-256 hash of the key. Values survive restarts,
+// so they can be shared between runs.
+type DiskCache struct {
+	Dir string
+}
+
+// NewDiskCache returns a DiskCache that stores files in dir.
+// The directory is created when the first value is stored.
+func NewDiskCache(dir string) *DiskCache {
+	return &DiskCache{Dir: dir}
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// Get implements CacheStore.
+func (c *DiskCache) Get(key string) ([]byte, error) {
+	b, err := ioutil.ReadFile(c.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrCacheMiss
+	}
+	return b, err
+}
+
+// Set implements CacheStore.
+func (c *DiskCache) Set(key string, value []byte) error {
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return err
+	}
+	return writeFile(c.path(key), value)
+}
+
+// Delete implements CacheStore.
+func (c *DiskCache) Delete(key string) error {
+	err := os.Remove(c.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Cache is a private HTTP cache, as described in RFC 9111. Responses to
+// GET requests are stored according to their Cache-Control and Expires
+// headers, and stale responses are revalidated with If-None-Match and
+// If-Modified-Since requests when they have an ETag or Last-Modified.
+// Successful unsafe requests, such as POST, invalidate the cached
+// response of their URL.
+type Cache struct {
+	// Store is where the responses are kept.
+	Store CacheStore
+
+	// ForceTTL, if positive, caches all 2xx responses to GET requests
+	// for this duration, ignoring the response headers. This is useful
+	// during development, to avoid fetching the same pages again.
+	ForceTTL time.Duration
+
+	// now is used in tests to change the current time.
+	now func() time.Time
+}
+
+// NewCache returns a Cache that keeps responses in the store.
+func NewCache(store CacheStore) *Cache {
+	return &Cache{Store: store}
+}
+
+// UseCache makes the Bot cache responses with c.
+// Use nil to disable the cache.
+func (bot *Bot) UseCache(c *Cache) *Bot {
+	bot.cache = c
+	return bot
+}
+
+// FromCache reports whether the page was served from the cache set
+// with UseCache, including after a successful revalidation.
+func (page *Page) FromCache() bool {
+	return page != nil && page.resp != nil && page.resp.Header.Get(cacheHeader) != ""
+}
+
+// cacheEntry is a stored response.
+type cacheEntry struct {
+	Status     string      `json:"status"`
+	StatusCode int         `json:"statusCode"`
+	Proto      string      `json:"proto"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+
+	// Vary are the request headers listed in the Vary response header.
+	Vary http.Header `json:"vary,omitempty"`
+
+	// Stored is when the response was received, or revalidated.
+	Stored time.Time `json:"stored"`
+
+	// Forced is set when the response was stored due to ForceTTL.
+	Forced bool `json:"forced,omitempty"`
+}
+
+// cacheCheckedStatus are the status codes that are cached without
+// explicit freshness information, as listed in RFC 9110.
+var cacheCheckedStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// cacheControl parses the Cache-Control directives in h.
+func cacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+// seconds parses a delta-seconds value.
+func seconds(s string) (time.Duration, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+func (c *Cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// cacheKey is the key of the response to r.
+func cacheKey(r *http.Request) string {
+	return "GET " + r.URL.String()
+}
+
+// load returns the entry stored for r, or nil.
+func (c *Cache) load(bot *Bot, r *http.Request) *cacheEntry {
+	b, err := c.Store.Get(cacheKey(r))
+	if err != nil {
+		if err != ErrCacheMiss {
+			bot.log().Warn("unable to read cache", "url", r.URL.String(), "err", err)
+		}
+		return nil
+	}
+	e := new(cacheEntry)
+	if err := json.Unmarshal(b, e); err != nil {
+		bot.log().Warn("invalid cache entry", "url", r.URL.String(), "err", err)
+		return nil
+	}
+	for name, values := range e.Vary {
+		if strings.Join(r.Header.Values(name), ",") != strings.Join(values, ",") {
+			return nil
+		}
+	}
+	return e
+}
+
+// save stores the entry for r.
+func (c *Cache) save(bot *Bot, r *http.Request, e *cacheEntry) {
+	b, err := json.Marshal(e)
+	if err == nil {
+		err = c.Store.Set(cacheKey(r), b)
+	}
+	if err != nil {
+		bot.log().Warn("unable to write cache", "url", r.URL.String(), "err", err)
+	}
+}
+
+// lifetime returns the freshness lifetime of the entry.
+func (e *cacheEntry) lifetime() time.Duration {
+	cc := cacheControl(e.Header)
+	if v, ok := cc["max-age"]; ok {
+		d, _ := seconds(v)
+		return d
+	}
+	date, err := http.ParseTime(e.Header.Get("Date"))
+	if err != nil {
+		date = e.Stored
+	}
+	if v := e.Header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil || expires.Before(date) {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	if !cacheCheckedStatus[e.StatusCode] {
+		return 0
+	}
+	// Heuristic freshness: 10% of the time since the last change.
+	if lm, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && lm.Before(date) {
+		return date.Sub(lm) / 10
+	}
+	return 0
+}
+
+// age returns the current age of the entry.
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	var age time.Duration
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil && e.Stored.After(date) {
+		age = e.Stored.Sub(date)
+	}
+	if d, ok := seconds(e.Header.Get("Age")); ok {
+		age += d
+	}
+	if now.After(e.Stored) {
+		age += now.Sub(e.Stored)
+	}
+	return age
+}
+
+// fresh reports whether the entry can be served to r without
+// revalidation.
+func (c *Cache) fresh(e *cacheEntry, r *http.Request, now time.Time) bool {
+	if e.Forced {
+		return c.ForceTTL > 0 && now.Sub(e.Stored) < c.ForceTTL
+	}
+	if _, ok := cacheControl(e.Header)["no-cache"]; ok {
+		return false
+	}
+	age := e.age(now)
+	if v, ok := cacheControl(r.Header)["max-age"]; ok {
+		if d, ok := seconds(v); ok && age > d {
+			return false
+		}
+	}
+	return age < e.lifetime()
+}
+
+// withoutCookies returns a copy of the header h without the cookies set
+// by the server, that must not be replayed from the cache, as
+// recommended in RFC 9111, section 3.1.
+func withoutCookies(h http.Header) http.Header {
+	h = h.Clone()
+	h.Del("Set-Cookie")
+	h.Del("Set-Cookie2")
+	return h
+}
+
+// response builds the response served from the entry.
+func (e *cacheEntry) response(r *http.Request, now time.Time) *http.Response {
+	h := withoutCookies(e.Header)
+	h.Set(cacheHeader, "1")
+	if !e.Forced {
+		h.Set("Age", strconv.Itoa(int(e.age(now)/time.Second)))
+	}
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         e.Proto,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       r,
+	}
+}
+
+// storable reports whether the response can be stored, and if it is
+// stored due to ForceTTL.
+func (c *Cache) storable(r *http.Request, resp *http.Response) (ok, forced bool) {
+	if c.ForceTTL > 0 && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return true, true
+	}
+	if _, ok := cacheControl(r.Header)["no-store"]; ok {
+		return false, false
+	}
+	cc := cacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false, false
+	}
+	if resp.Header.Get("Vary") == "*" {
+		return false, false
+	}
+	_, maxAge := cc["max-age"]
+	explicit := maxAge || resp.Header.Get("Expires") != ""
+	validator := resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+	return explicit || (cacheCheckedStatus[resp.StatusCode] && validator), false
+}
+
+// roundTrip serves r from the cache, or sends it with next and caches
+// the response.
+func (c *Cache) roundTrip(bot *Bot, next http.RoundTripper, r *http.Request) (*http.Response, error) {
+	logger := bot.log()
+	if r.Method != "GET" {
+		resp, err := next.RoundTrip(r)
+		if err == nil && r.Method != "HEAD" && r.Method != "OPTIONS" && r.Method != "TRACE" &&
+			resp.StatusCode >= 200 && resp.StatusCode <= 399 {
+			c.invalidate(bot, r, resp)
+		}
+		return resp, err
+	}
+	// Requests with their own conditionals or ranges are not cached.
+	for _, h := range []string{"If-None-Match", "If-Modified-Since", "Range"} {
+		if r.Header.Get(h) != "" {
+			return next.RoundTrip(r)
+		}
+	}
+	reqCC := cacheControl(r.Header)
+	if _, ok := reqCC["no-store"]; ok && c.ForceTTL <= 0 {
+		return next.RoundTrip(r)
+	}
+
+	now := c.clock()
+	e := c.load(bot, r)
+	_, noCache := reqCC["no-cache"]
+	noCache = noCache || r.Header.Get("Pragma") == "no-cache"
+	if e != nil && !noCache && c.fresh(e, r, now) {
+		logger.Debug("cache hit", "url", r.URL.String())
+		return e.response(r, now), nil
+	}
+	if _, ok := reqCC["only-if-cached"]; ok {
+		if e != nil {
+			return e.response(r, now), nil
+		}
+		return &http.Response{
+			Status:     "504 Gateway Timeout",
+			StatusCode: http.StatusGatewayTimeout,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    r,
+		}, nil
+	}
+
+	send := r
+	if e != nil && !e.Forced {
+		etag, lm := e.Header.Get("ETag"), e.Header.Get("Last-Modified")
+		if etag != "" || lm != "" {
+			send = r.Clone(r.Context())
+			if etag != "" {
+				send.Header.Set("If-None-Match", etag)
+			}
+			if lm != "" {
+				send.Header.Set("If-Modified-Since", lm)
+			}
+		}
+	}
+	resp, err := next.RoundTrip(send)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotModified && send != r {
+		resp.Body.Close()
+		logger.Debug("cache revalidated", "url", r.URL.String())
+		for name, values := range resp.Header {
+			switch http.CanonicalHeaderKey(name) {
+			case "Content-Length", "Content-Encoding", "Content-Type", "Transfer-Encoding",
+				"Set-Cookie", "Set-Cookie2":
+				continue
+			}
+			e.Header[name] = values
+		}
+		e.Header.Del("Age")
+		e.Stored = c.clock()
+		c.save(bot, r, e)
+		return e.response(r, e.Stored), nil
+	}
+	if ok, forced := c.storable(r, resp); ok {
+		return c.store(bot, r, resp, forced)
+	}
+	if e != nil {
+		c.invalidate(bot, r, resp)
+	}
+	return resp, nil
+}
+
+// store saves the response, and returns a copy of it to the caller.
+func (c *Cache) store(bot *Bot, r *http.Request, resp *http.Response, forced bool) (*http.Response, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	e := &cacheEntry{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Header:     withoutCookies(resp.Header),
+		Body:       body,
+		Stored:     c.clock(),
+		Forced:     forced,
+	}
+	for _, line := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				if e.Vary == nil {
+					e.Vary = make(http.Header)
+				}
+				e.Vary[http.CanonicalHeaderKey(name)] = r.Header.Values(name)
+			}
+		}
+	}
+	c.save(bot, r, e)
+	return resp, nil
+}
+
+// invalidate removes the cached responses of the URL changed by r,
+// and of the Location and Content-Location of the response, if they
+// have the same host.
+func (c *Cache) invalidate(bot *Bot, r *http.Request, resp *http.Response) {
+	urls := []string{r.URL.String()}
+	for _, h := range []string{"Location", "Content-Location"} {
+		if v := resp.Header.Get(h); v != "" {
+			if u, err := r.URL.Parse(v); err == nil && u.Host == r.URL.Host {
+				urls = append(urls, u.String())
+			}
+		}
+	}
+	for _, u := range urls {
+		if err := c.Store.Delete("GET " + u); err != nil {
+			bot.log().Warn("unable to invalidate cache", "url", u, "err", err)
+		}
+	}
+}
+
+// cacheResponses serves and stores responses with the Cache set with
+// Bot.UseCache.
+func (bot *Bot) cacheResponses(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if bot.cache == nil {
+			return next.RoundTrip(r)
+		}
+		return bot.cache.roundTrip(bot, next, r)
+	})
+}
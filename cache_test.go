@@ -0,0 +1,175 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+// cacheSite serves pages with the provided headers, counting the
+// requests to each path. Requests with a matching If-None-Match or
+// If-Modified-Since get a 304 Not Modified. The Date header is not
+// sent, so the tests can change the cache clock.
+type cacheSite struct {
+	*bottest.Site
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func newCacheSite(pages map[string]http.Header) *cacheSite {
+	s := &cacheSite{Site: bottest.NewSite(), hits: make(map[string]int)}
+	for path, h := range pages {
+		path, h := path, h
+		s.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			s.mu.Lock()
+			s.hits[r.Method+" "+path]++
+			n := s.hits[r.Method+" "+path]
+			s.mu.Unlock()
+			w.Header()["Date"] = nil
+			for k, v := range h {
+				w.Header()[k] = v
+			}
+			if r.Method == "POST" {
+				fmt.Fprint(w, "POSTED")
+				return
+			}
+			etag, lm := h.Get("ETag"), h.Get("Last-Modified")
+			if (etag != "" && r.Header.Get("If-None-Match") == etag) ||
+				(lm != "" && r.Header.Get("If-Modified-Since") == lm) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fmt.Fprintf(w, "%s #%d", path, n)
+		})
+	}
+	return s
+}
+
+func (s *cacheSite) count(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[key]
+}
+
+func cacheGET(t *testing.T, b *Bot, path, body string, fromCache bool) {
+	t.Helper()
+	page, err := b.GET(path)
+	if err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	checkBody(t, page, body)
+	if page.FromCache() != fromCache {
+		t.Errorf("GET %s: FromCache() = %v, want %v", path, page.FromCache(), fromCache)
+	}
+}
+
+func TestCache(t *testing.T) {
+	s := newCacheSite(map[string]http.Header{
+		"/fresh":   {"Cache-Control": {"max-age=60"}, "Etag": {`"v1"`}},
+		"/expires": {"Expires": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}},
+		"/lm":      {"Last-Modified": {time.Now().Add(-100 * time.Minute).UTC().Format(http.TimeFormat)}},
+		"/nostore": {"Cache-Control": {"no-store"}},
+		"/plain":   {},
+	})
+	defer s.Close()
+
+	now := time.Now()
+	c := NewCache(NewMemoryCache())
+	c.now = func() time.Time { return now }
+	b := New().BaseURL(s.URL).UseCache(c)
+
+	cacheGET(t, b, "/fresh", "/fresh #1", false)
+	cacheGET(t, b, "/fresh", "/fresh #1", true)
+	cacheGET(t, b, "/expires", "/expires #1", false)
+	cacheGET(t, b, "/expires", "/expires #1", true)
+	cacheGET(t, b, "/nostore", "/nostore #1", false)
+	cacheGET(t, b, "/nostore", "/nostore #2", false)
+	cacheGET(t, b, "/plain", "/plain #1", false)
+	cacheGET(t, b, "/plain", "/plain #2", false)
+	// Heuristic freshness of 10 minutes, from the Last-Modified.
+	cacheGET(t, b, "/lm", "/lm #1", false)
+	cacheGET(t, b, "/lm", "/lm #1", true)
+
+	// Stale responses are revalidated.
+	now = now.Add(15 * time.Minute)
+	cacheGET(t, b, "/fresh", "/fresh #1", true)
+	cacheGET(t, b, "/lm", "/lm #1", true)
+	if got := s.count("GET /fresh"); got != 2 {
+		t.Errorf("Expected 2 requests to /fresh, got %d", got)
+	}
+	s.AssertHeader(t, "/fresh", "If-None-Match", `"v1"`)
+	if got := s.count("GET /lm"); got != 2 {
+		t.Errorf("Expected 2 requests to /lm, got %d", got)
+	}
+	// The revalidated response is fresh again.
+	cacheGET(t, b, "/fresh", "/fresh #1", true)
+	if got := s.count("GET /fresh"); got != 2 {
+		t.Errorf("Expected 2 requests to /fresh, got %d", got)
+	}
+
+	// Requests with no-cache are revalidated.
+	req, _ := http.NewRequest("GET", s.URL+"/fresh", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	if _, err := b.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.count("GET /fresh"); got != 3 {
+		t.Errorf("Expected 3 requests to /fresh, got %d", got)
+	}
+
+	// Unsafe requests invalidate the cache.
+	if _, err := b.POST("/expires", url.Values{}); err != nil {
+		t.Fatal(err)
+	}
+	cacheGET(t, b, "/expires", "/expires #2", false)
+}
+
+func TestCacheForceTTL(t *testing.T) {
+	s := newCacheSite(map[string]http.Header{
+		"/nostore": {"Cache-Control": {"no-store"}},
+	})
+	defer s.Close()
+
+	now := time.Now()
+	c := NewCache(NewDiskCache(t.TempDir()))
+	c.ForceTTL = 5 * time.Minute
+	c.now = func() time.Time { return now }
+	b := New().BaseURL(s.URL).UseCache(c)
+	cacheGET(t, b, "/nostore", "/nostore #1", false)
+	cacheGET(t, b, "/nostore", "/nostore #1", true)
+
+	// The disk cache is shared with other Bots.
+	b2 := New().BaseURL(s.URL).UseCache(c)
+	cacheGET(t, b2, "/nostore", "/nostore #1", true)
+
+	now = now.Add(6 * time.Minute)
+	cacheGET(t, b, "/nostore", "/nostore #2", false)
+}
+
+func TestCacheCookies(t *testing.T) {
+	s := newCacheSite(map[string]http.Header{
+		"/home":  {"Cache-Control": {"max-age=60"}, "Set-Cookie": {"sid=old; Path=/"}},
+		"/login": {"Set-Cookie": {"sid=new; Path=/"}},
+	})
+	defer s.Close()
+
+	b := New().BaseURL(s.URL).UseCache(NewCache(NewMemoryCache()))
+	cacheGET(t, b, "/home", "/home #1", false)
+	if _, err := b.POST("/login", url.Values{"user": {"bot"}}); err != nil {
+		t.Fatal(err)
+	}
+	cacheGET(t, b, "/home", "/home #1", true)
+	u, _ := url.Parse(s.URL)
+	cookies := b.j.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Value != "new" {
+		t.Errorf("Expected the session cookie from login, got %v", cookies)
+	}
+}
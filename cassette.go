@@ -0,0 +1,312 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrNoInteraction is returned when a Cassette in replay mode
+// has no recorded interaction matching the request.
+var ErrNoInteraction = errors.New("bot: no recorded interaction matches the request")
+
+// CassetteMode defines if a Cassette records or replays interactions.
+type CassetteMode int
+
+const (
+	// ModeReplay serves recorded interactions, without using the network.
+	ModeReplay CassetteMode = iota
+	// ModeRecord sends requests to the network and records them.
+	ModeRecord
+)
+
+// MatchFlag selects which request attributes are compared by a Matcher.
+type MatchFlag int
+
+const (
+	// MatchMethod compares the request methods.
+	MatchMethod MatchFlag = 1 << iota
+	// MatchURL compares the request URLs.
+	MatchURL
+	// MatchBody compares the request bodies.
+	MatchBody
+)
+
+// Matcher reports whether the recorded request rec matches the
+// request r, which has the provided body. Sensitive headers and secret
+// form fields are redacted from r, as in the recording.
+type Matcher func(r *http.Request, body []byte, rec *CassetteRequest) bool
+
+// DefaultMatcher matches requests by method and URL.
+var DefaultMatcher = Match(MatchMethod | MatchURL)
+
+// Match returns a Matcher comparing the attributes selected by flags,
+// as well as the values of the provided headers. Redacted headers are
+// compared without their values, so only cookie names are compared.
+func Match(flags MatchFlag, headers ...string) Matcher {
+	return func(r *http.Request, body []byte, rec *CassetteRequest) bool {
+		if flags&MatchMethod != 0 && r.Method != rec.Method {
+			return false
+		}
+		if flags&MatchURL != 0 && r.URL.String() != rec.URL {
+			return false
+		}
+		if flags&MatchBody != 0 && !bytes.Equal(body, rec.Body.bytes()) {
+			return false
+		}
+		for _, h := range headers {
+			if r.Header.Get(h) != rec.Header.Get(h) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Interaction is a recorded request and response pair.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is a recorded request. Sensitive headers and secret
+// form fields are redacted with the Bot DumpConfig, or the defaults.
+type CassetteRequest struct {
+	Method string       `json:"method"`
+	URL    string       `json:"url"`
+	Header http.Header  `json:"header"`
+	Body   CassetteBody `json:"body"`
+}
+
+// CassetteResponse is a recorded response. Sensitive headers, such as
+// Set-Cookie, are redacted as in the request.
+type CassetteResponse struct {
+	Status     string       `json:"status"`
+	StatusCode int          `json:"statusCode"`
+	Proto      string       `json:"proto"`
+	Header     http.Header  `json:"header"`
+	Body       CassetteBody `json:"body"`
+}
+
+// CassetteBody is a recorded body. Text bodies are stored as is,
+// and binary bodies are base64 encoded.
+type CassetteBody struct {
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+func newCassetteBody(b []byte) CassetteBody {
+	if utf8.Valid(b) {
+		return CassetteBody{Text: string(b)}
+	}
+	return CassetteBody{Text: base64.StdEncoding.EncodeToString(b), Encoding: "base64"}
+}
+
+func (b CassetteBody) bytes() []byte {
+	if b.Encoding == "base64" {
+		data, _ := base64.StdEncoding.DecodeString(b.Text)
+		return data
+	}
+	return []byte(b.Text)
+}
+
+// Cassette records the Bot interactions to a file, and replays them
+// back so tests can run offline and deterministically.
+// It is safe for concurrent use.
+type Cassette struct {
+	// Path is the file where interactions are stored.
+	Path string
+
+	// Mode defines if interactions are recorded or replayed.
+	Mode CassetteMode
+
+	// Matcher selects the recorded interaction to replay.
+	// If nil, DefaultMatcher is used.
+	Matcher Matcher
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewCassette initializes a new Cassette with the provided mode.
+// In replay mode, the interactions are loaded from the file at path.
+// In record mode, the file is overwritten with the interactions
+// recorded when Close or Save is called.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{Path: path, Mode: mode}
+	if mode != ModeReplay {
+		return c, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.interactions); err != nil {
+		return nil, fmt.Errorf("bot: invalid cassette %s: %v", path, err)
+	}
+	c.used = make([]bool, len(c.interactions))
+	return c, nil
+}
+
+// UseCassette makes the Bot record or replay interactions with c.
+// Use nil to go back to the network.
+func (bot *Bot) UseCassette(c *Cassette) *Bot {
+	bot.cassette = c
+	return bot
+}
+
+// Interactions returns the interactions recorded or loaded so far.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make([]Interaction, len(c.interactions))
+	for i, in := range c.interactions {
+		result[i] = *in
+	}
+	return result
+}
+
+// Close writes the recorded interactions to the cassette file,
+// in record mode.
+func (c *Cassette) Close() error {
+	if c.Mode != ModeRecord {
+		return nil
+	}
+	return c.Save()
+}
+
+// Save writes the recorded interactions to the cassette file.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.save()
+}
+
+func (c *Cassette) save() error {
+	b, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(c.Path, b)
+}
+
+// writeFile atomically replaces the file at path with data, so
+// readers never see a partially written file.
+func writeFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// roundTrip records the request r sent with next, or replays it
+// from the cassette, depending on the cassette mode.
+func (c *Cassette) roundTrip(bot *Bot, next http.RoundTripper, r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	cfg := bot.dumper()
+	if cfg == nil {
+		cfg = defaultDump
+	}
+	body = bot.redactBody(cfg, r.Header.Get("Content-Type"), body)
+	header := cfg.redactHeaders(r.Header)
+	if c.Mode == ModeReplay {
+		return c.replay(r, header, body)
+	}
+
+	resp, err := next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	in := &Interaction{
+		Request: CassetteRequest{
+			Method: r.Method,
+			URL:    r.URL.String(),
+			Header: header,
+			Body:   newCassetteBody(body),
+		},
+		Response: CassetteResponse{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Proto:      resp.Proto,
+			Header:     cfg.redactHeaders(resp.Header),
+			Body:       newCassetteBody(respBody),
+		},
+	}
+	// The response headers are already decoded by the transport.
+	in.Response.Header.Del("Content-Encoding")
+	in.Response.Header.Del("Content-Length")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, in)
+	c.used = append(c.used, true)
+	return resp, nil
+}
+
+// replay returns the first unused interaction that matches r,
+// compared with the redacted header and body.
+func (c *Cassette) replay(r *http.Request, header http.Header, body []byte) (*http.Response, error) {
+	match := c.Matcher
+	if match == nil {
+		match = DefaultMatcher
+	}
+	req := r.WithContext(r.Context())
+	req.Header = header
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, in := range c.interactions {
+		if c.used[i] || !match(req, body, &in.Request) {
+			continue
+		}
+		c.used[i] = true
+		respBody := in.Response.Body.bytes()
+		return &http.Response{
+			Status:        in.Response.Status,
+			StatusCode:    in.Response.StatusCode,
+			Proto:         in.Response.Proto,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       r,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s (cassette %s)", ErrNoInteraction, r.Method, r.URL, c.Path)
+}
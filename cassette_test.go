@@ -0,0 +1,101 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	s := newTestSite()
+
+	rec, err := NewCassette(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := ReuseClient(&http.Client{}).UseCassette(rec)
+	b.redactField("pass")
+	if _, err := b.POST(s.URL+"/login/", url.Values{"user": {"ronoaldo"}, "pass": {"secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	page, err := b.GET(s.URL + "/private/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "PRIVATE")
+	s.Close()
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if bytes.Contains(data, []byte("secret")) {
+		t.Errorf("Expected the password to be redacted:\n%s", data)
+	}
+	cookies := 0
+	for _, in := range rec.Interactions() {
+		for _, h := range []http.Header{in.Request.Header, in.Response.Header} {
+			for _, v := range append(h.Values("Cookie"), h.Values("Set-Cookie")...) {
+				cookies++
+				if !strings.Contains(v, "="+redacted) {
+					t.Errorf("Expected the cookie values to be redacted, got %q", v)
+				}
+			}
+		}
+	}
+	if cookies != 2 {
+		t.Errorf("Expected the session cookie to be set and sent, got %d cookie headers", cookies)
+	}
+
+	play, err := NewCassette(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(play.Interactions()); n != 2 {
+		t.Fatalf("Expected 2 recorded interactions, got %d", n)
+	}
+	play.Matcher = Match(MatchMethod|MatchURL|MatchBody, "Cookie")
+	b = ReuseClient(&http.Client{}).UseCassette(play)
+	b.redactField("pass")
+	if _, err := b.POST(s.URL+"/login/", url.Values{"user": {"ronoaldo"}, "pass": {"secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	if page, err = b.GET(s.URL + "/private/"); err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "PRIVATE")
+
+	// All interactions were used, so a new request must fail.
+	if _, err = b.GET(s.URL + "/private/"); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("Expected ErrNoInteraction, got %v", err)
+	}
+}
+
+func TestCassetteMatchBody(t *testing.T) {
+	c := &Cassette{
+		Mode:    ModeReplay,
+		Matcher: Match(MatchMethod|MatchURL|MatchBody, "X-Requested-With"),
+		interactions: []*Interaction{{
+			Request:  CassetteRequest{Method: "POST", URL: "http://example.com/", Body: newCassetteBody([]byte("a=1"))},
+			Response: CassetteResponse{Status: "200 OK", StatusCode: 200, Body: newCassetteBody([]byte("OK"))},
+		}},
+		used: []bool{false},
+	}
+	b := ReuseClient(&http.Client{}).UseCassette(c)
+	if _, err := b.POST("http://example.com/", url.Values{"a": {"2"}}); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("Expected ErrNoInteraction for a different body, got %v", err)
+	}
+	page, err := b.POST("http://example.com/", url.Values{"a": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "OK")
+}
@@ -2,10 +2,12 @@ package bot
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 type CookieJar struct {
@@ -20,7 +22,7 @@ func (bot *Bot) EncodeCookies() ([]byte, error) {
 	for i := range history {
 		u, err := url.Parse(history[i])
 		if err != nil {
-			log.Printf("Invalid URL in history! Skipping cookies from it: " + history[i])
+			bot.log().Warn("invalid URL in history, skipping its cookies", "url", history[i], "err", err)
 			continue
 		}
 		jar.Data[u.String()] = bot.j.Cookies(u)
@@ -40,7 +42,7 @@ func (bot *Bot) DecodeCookies(cookies []byte) error {
 		v := jar.Data[k]
 		u, err := url.Parse(k)
 		if err != nil {
-			log.Printf("Invalid URL from cookies! Skipping: " + k)
+			bot.log().Warn("invalid URL in cookies, skipping", "url", k, "err", err)
 			continue
 		}
 		bot.j.SetCookies(u, v)
@@ -56,9 +58,111 @@ func (bot *Bot) SetCookie(c *http.Cookie) {
 	}
 	u := &url.URL{
 		Scheme: "http",
-		Host: host,
+		Host:   host,
 	}
-	log.Printf("Setting cookie: u=%v ; value=%v", u, c)
+	bot.log().Debug("cookie set", "url", u.String(), "name", c.Name, "domain", c.Domain)
 	bot.j.SetCookies(u, []*http.Cookie{c})
 	bot.History().Add(u.String())
-}
\ No newline at end of file
+}
+
+// cookieRecorder is a cookie jar that keeps the cookies set through it
+// with all their attributes, such as Path and Expires, that the Cookies
+// method of a jar does not return. It is used to save a crawl session
+// that can be restored exactly.
+type cookieRecorder struct {
+	http.CookieJar
+
+	mu      sync.Mutex
+	seq     int
+	cookies map[cookieID]*recordedCookie
+}
+
+// cookieID identifies a cookie in a jar: cookies with the same domain,
+// path and name replace each other.
+type cookieID struct {
+	domain   string
+	hostOnly bool
+	path     string
+	name     string
+}
+
+// recordedCookie is a cookie and the URL that set it.
+type recordedCookie struct {
+	url    string
+	cookie *http.Cookie
+	seq    int
+}
+
+func newCookieRecorder(j http.CookieJar) *cookieRecorder {
+	return &cookieRecorder{CookieJar: j, cookies: make(map[cookieID]*recordedCookie)}
+}
+
+// SetCookies records the cookies, and sets them in the jar.
+func (r *cookieRecorder) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	r.CookieJar.SetCookies(u, cookies)
+	origin := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range cookies {
+		id := cookieID{
+			domain: strings.ToLower(strings.TrimPrefix(c.Domain, ".")),
+			path:   c.Path,
+			name:   c.Name,
+		}
+		if id.domain == "" {
+			id.domain, id.hostOnly = strings.ToLower(u.Hostname()), true
+		}
+		if !strings.HasPrefix(id.path, "/") {
+			id.path = defaultCookiePath(u.Path)
+		}
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(time.Now())) {
+			delete(r.cookies, id)
+			continue
+		}
+		saved := *c
+		if saved.MaxAge > 0 {
+			// Max-Age is relative to when the cookie is set,
+			// so it is saved as an absolute expiration.
+			saved.Expires = time.Now().Add(time.Duration(saved.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+		r.seq++
+		r.cookies[id] = &recordedCookie{url: origin.String(), cookie: &saved, seq: r.seq}
+	}
+}
+
+// jar returns the cookies recorded and not expired yet, by the URL
+// that set them, in the order they were set.
+func (r *cookieRecorder) jar() *CookieJar {
+	r.mu.Lock()
+	recorded := make([]*recordedCookie, 0, len(r.cookies))
+	for _, rc := range r.cookies {
+		recorded = append(recorded, rc)
+	}
+	r.mu.Unlock()
+	sort.Slice(recorded, func(i, j int) bool { return recorded[i].seq < recorded[j].seq })
+
+	jar := &CookieJar{Data: make(map[string][]*http.Cookie)}
+	now := time.Now()
+	for _, rc := range recorded {
+		c := rc.cookie
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			continue
+		}
+		jar.Data[rc.url] = append(jar.Data[rc.url], c)
+	}
+	return jar
+}
+
+// defaultCookiePath returns the default path of a cookie set by a
+// response to a request with the given path, as in RFC 6265 section 5.1.4.
+func defaultCookiePath(p string) string {
+	if p == "" || p[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(p, "/")
+	if i == 0 {
+		return "/"
+	}
+	return p[:i]
+}
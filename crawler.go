@@ -0,0 +1,443 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultCrawlWorkers is the number of workers used when the Crawler
+// does not set Workers.
+const DefaultCrawlWorkers = 4
+
+// DefaultCheckpointEvery is the number of pages visited between
+// checkpoints when the Crawler does not set CheckpointEvery.
+const DefaultCheckpointEvery = 50
+
+// ErrSkipLinks can be returned by a CrawlHandler to not follow the
+// links in the page. It does not stop the crawl.
+var ErrSkipLinks = errors.New("bot: skip links")
+
+// CrawlHandler is called by the Crawler for each page loaded. The depth
+// is the number of links followed from the seed URL. Returning an error
+// other than ErrSkipLinks stops the crawl. Handlers are called
+// concurrently by the Crawler workers. The body of a page not read by
+// the handler is discarded when it returns.
+type CrawlHandler func(page *Page, depth int) error
+
+// Scope restricts the URLs visited by a Crawler. URLs are matched after
+// being normalized with NormalizeURL.
+type Scope struct {
+	// Hosts are the hosts that can be visited, including the port if
+	// any. If empty, only the hosts of the seed URLs are visited.
+	Hosts []string
+
+	// PathPrefixes, if not empty, restricts the URL paths visited.
+	PathPrefixes []string
+
+	// Include, if not empty, restricts the visited URLs to the ones
+	// matching any of the expressions.
+	Include []*regexp.Regexp
+
+	// Exclude prevents visiting URLs matching any of the expressions.
+	Exclude []*regexp.Regexp
+
+	// MaxDepth is the maximum number of links followed from the seeds.
+	// If zero, there is no limit.
+	MaxDepth int
+}
+
+// Allows reports whether the URL at depth is in the scope.
+func (s *Scope) Allows(u *url.URL, depth int) bool {
+	if s.MaxDepth > 0 && depth > s.MaxDepth {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if !matchAny(s.Hosts, func(h string) bool { return strings.EqualFold(h, u.Host) }) {
+		return false
+	}
+	if len(s.PathPrefixes) > 0 && !matchAny(s.PathPrefixes, func(p string) bool { return strings.HasPrefix(u.Path, p) }) {
+		return false
+	}
+	target := u.String()
+	for _, re := range s.Exclude {
+		if re.MatchString(target) {
+			return false
+		}
+	}
+	if len(s.Include) == 0 {
+		return true
+	}
+	for _, re := range s.Include {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether match is true for any of the values.
+func matchAny(values []string, match func(string) bool) bool {
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeURL returns the URL in a canonical form, used to detect
+// duplicates: the scheme and host are lower case, the default port,
+// the fragment and dot segments are removed, the path is never empty,
+// and the query parameters are sorted.
+func NormalizeURL(u *url.URL) *url.URL {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if (n.Scheme == "http" && n.Port() == "80") || (n.Scheme == "https" && n.Port() == "443") {
+		n.Host = n.Hostname()
+		if strings.Contains(n.Host, ":") {
+			n.Host = "[" + n.Host + "]"
+		}
+	}
+	n.Fragment, n.RawFragment = "", ""
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	n = *n.ResolveReference(&url.URL{Path: n.Path, RawPath: n.RawPath, RawQuery: n.RawQuery})
+	if n.RawQuery != "" {
+		q := strings.Split(n.RawQuery, "&")
+		sort.Strings(q)
+		n.RawQuery = strings.Join(q, "&")
+	}
+	n.ForceQuery = false
+	return &n
+}
+
+// Links returns the unique URLs of the links and frames in the page,
+// resolved against the page URL, in document order. Only HTTP and
+// HTTPS links are returned.
+func (page *Page) Links() ([]*url.URL, error) {
+	doc, err := page.document()
+	if err != nil {
+		return nil, err
+	}
+	base := page.URL()
+	if base == nil {
+		return nil, errNilResp
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			base = u
+		}
+	}
+	var links []*url.URL
+	seen := make(map[string]bool)
+	doc.Find("a[href], area[href], frame[src], iframe[src]").Each(func(i int, s *goquery.Selection) {
+		ref := s.AttrOr("href", s.AttrOr("src", ""))
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment, u.RawFragment = "", ""
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			links = append(links, u)
+		}
+	})
+	return links, nil
+}
+
+// CrawlEntry is an URL in the Crawler frontier, or already visited.
+type CrawlEntry struct {
+	// URL is the normalized URL.
+	URL string `json:"url"`
+
+	// Depth is the number of links followed from the seed URL.
+	Depth int `json:"depth"`
+
+	// Referer and Policy are the URL and Referrer-Policy of the page
+	// where the link was found.
+	Referer string `json:"referer,omitempty"`
+	Policy  string `json:"policy,omitempty"`
+
+	// Status is the HTTP status code of the visited URL,
+	// or zero if there was a network error.
+	Status int `json:"status,omitempty"`
+
+	// Final is the normalized URL after redirects, if different.
+	Final string `json:"final,omitempty"`
+
+	// Error is the error loading the URL, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// source returns the navigation source of the entry. Seeds have an
+// empty source, so they are not sent with the Referer of the last page
+// loaded by another worker.
+func (e *CrawlEntry) source() *source {
+	src := &source{policy: e.Policy}
+	if e.Referer != "" {
+		src.url, _ = url.Parse(e.Referer)
+	}
+	return src
+}
+
+// Crawler visits all pages reachable from seed URLs, within a Scope.
+// Workers share the same Bot, and thus the same session cookies.
+type Crawler struct {
+	// Scope restricts the URLs visited.
+	Scope Scope
+
+	// Workers is the number of pages loaded concurrently.
+	// If zero, DefaultCrawlWorkers is used.
+	Workers int
+
+	// OnError, if not nil, is called when a page can not be loaded.
+	// By default, errors are logged, and the crawl continues.
+	OnError func(url string, err error)
+
+	// Store, if not nil, is where the crawl state is saved,
+	// every CheckpointEvery pages and when the crawl stops.
+	Store StateStore
+
+	// CheckpointEvery is the number of pages visited between
+	// checkpoints. If zero, DefaultCheckpointEvery is used.
+	CheckpointEvery int
+
+	bot     *Bot
+	handler CrawlHandler
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	seeds    []string
+	queue    []CrawlEntry
+	inflight map[string]CrawlEntry
+	visited  []CrawlEntry
+	seen     map[string]bool
+	active   int
+	err      error
+
+	// saveMu serializes checkpoints.
+	saveMu sync.Mutex
+}
+
+// NewCrawler returns a Crawler that loads pages with bot,
+// and calls handler for each one.
+func NewCrawler(bot *Bot, handler CrawlHandler) *Crawler {
+	c := &Crawler{
+		bot:      bot,
+		handler:  handler,
+		inflight: make(map[string]CrawlEntry),
+		seen:     make(map[string]bool),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Run crawls the pages reachable from the seed URLs, until all pages in
+// scope are visited, the context is canceled, or the handler returns an
+// error. Seeds are prefixed with the Bot BaseURL, as in Bot.GET, and are
+// visited even if they are not in scope.
+func (c *Crawler) Run(ctx context.Context, seeds ...string) error {
+	for _, seed := range seeds {
+		u, err := url.Parse(c.bot.b + seed)
+		if err != nil {
+			return err
+		}
+		u = NormalizeURL(u)
+		c.seeds = append(c.seeds, u.String())
+		c.enqueue(CrawlEntry{URL: u.String()})
+	}
+	return c.run(ctx)
+}
+
+// run starts the workers, and waits until the crawl stops.
+func (c *Crawler) run(ctx context.Context) error {
+	if len(c.Scope.Hosts) == 0 {
+		for _, seed := range c.seeds {
+			if u, err := url.Parse(seed); err == nil {
+				c.Scope.Hosts = append(c.Scope.Hosts, u.Host)
+			}
+		}
+	}
+	stop := context.AfterFunc(ctx, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.cond.Broadcast()
+	})
+	defer stop()
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = DefaultCrawlWorkers
+	}
+	every := c.CheckpointEvery
+	if every <= 0 {
+		every = DefaultCheckpointEvery
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				entry, ok := c.take(ctx)
+				if !ok {
+					return
+				}
+				done := c.visit(ctx, &entry)
+				c.mu.Lock()
+				delete(c.inflight, entry.URL)
+				if done {
+					c.visited = append(c.visited, entry)
+				} else {
+					// Visit again when the crawl is resumed.
+					c.queue = append([]CrawlEntry{entry}, c.queue...)
+				}
+				checkpoint := c.Store != nil && done && len(c.visited)%every == 0
+				c.active--
+				c.cond.Broadcast()
+				c.mu.Unlock()
+				if checkpoint {
+					if err := c.Checkpoint(); err != nil {
+						c.bot.log().Warn("crawl checkpoint failed", "err", err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if c.Store != nil {
+		if err := c.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	if c.err != nil {
+		return c.err
+	}
+	return ctx.Err()
+}
+
+// enqueue adds the entry to the frontier, unless it was already seen.
+func (c *Crawler) enqueue(entry CrawlEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[entry.URL] {
+		return
+	}
+	c.seen[entry.URL] = true
+	c.queue = append(c.queue, entry)
+	c.cond.Signal()
+}
+
+// take waits for the next entry in the frontier. It returns false when
+// the crawl is done.
+func (c *Crawler) take(ctx context.Context) (CrawlEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.queue) == 0 && c.active > 0 && c.err == nil && ctx.Err() == nil {
+		c.cond.Wait()
+	}
+	if len(c.queue) == 0 || c.err != nil || ctx.Err() != nil {
+		return CrawlEntry{}, false
+	}
+	entry := c.queue[0]
+	c.queue = c.queue[1:]
+	c.inflight[entry.URL] = entry
+	c.active++
+	return entry, true
+}
+
+// visit loads the page, calls the handler, and enqueues the links.
+// It records the result in entry, and returns false if the page
+// must be visited again, because the crawl was stopped.
+func (c *Crawler) visit(ctx context.Context, entry *CrawlEntry) bool {
+	logger := c.bot.log()
+	req, err := http.NewRequestWithContext(ctx, "GET", entry.URL, nil)
+	if err != nil {
+		entry.Error = err.Error()
+		c.fail(entry.URL, err)
+		return true
+	}
+	req = withSource(req, entry.source())
+	page, err := c.bot.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		var se *StatusError
+		if errors.As(err, &se) {
+			entry.Status = se.StatusCode
+		}
+		entry.Error = err.Error()
+		c.fail(entry.URL, err)
+		return true
+	}
+	defer page.discard()
+	entry.Status = page.resp.StatusCode
+	final := NormalizeURL(page.URL())
+	if final.String() != entry.URL {
+		// Do not visit the redirect target again.
+		entry.Final = final.String()
+		c.mu.Lock()
+		seen := c.seen[entry.Final]
+		c.seen[entry.Final] = true
+		c.mu.Unlock()
+		if seen || (entry.Referer != "" && !c.Scope.Allows(final, entry.Depth)) {
+			logger.Debug("crawl skipped redirect", "url", entry.URL, "target", entry.Final)
+			return true
+		}
+	}
+	if err := c.handler(page, entry.Depth); err == ErrSkipLinks {
+		return true
+	} else if err != nil {
+		entry.Error = err.Error()
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = err
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		return true
+	}
+	ct, _, _ := mime.ParseMediaType(page.resp.Header.Get("Content-Type"))
+	if ct != "text/html" && ct != "application/xhtml+xml" {
+		return true
+	}
+	links, err := page.Links()
+	if err != nil {
+		logger.Warn("crawl unable to parse links", "url", entry.URL, "err", err)
+		return true
+	}
+	referer, policy := page.URL().String(), page.ReferrerPolicy()
+	for _, link := range links {
+		u := NormalizeURL(link)
+		if c.Scope.Allows(u, entry.Depth+1) {
+			c.enqueue(CrawlEntry{URL: u.String(), Depth: entry.Depth + 1, Referer: referer, Policy: policy})
+		}
+	}
+	return true
+}
+
+// fail reports an error loading the URL.
+func (c *Crawler) fail(url string, err error) {
+	if c.OnError != nil {
+		c.OnError(url, err)
+		return
+	}
+	c.bot.log().Warn("crawl failed", "url", url, "err", err)
+}
@@ -0,0 +1,163 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	for raw, want := range map[string]string{
+		"HTTP://Example.COM":                 "http://example.com/",
+		"http://example.com:80/a/./b/../c#x": "http://example.com/a/c",
+		"https://example.com:443/?b=2&a=1":   "https://example.com/?a=1&b=2",
+		"https://example.com:8443/a%2Fb":     "https://example.com:8443/a%2Fb",
+	} {
+		u, _ := url.Parse(raw)
+		if got := NormalizeURL(u).String(); got != want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestCrawler(t *testing.T) {
+	other := bottest.NewSite().Page("/", "OTHER")
+	defer other.Close()
+	s := bottest.NewSite().
+		Page("/", `<a href="/a/">A</a> <a href="b?y=1&x=2">B</a> <a href="/b?x=2&y=1#top">B</a>
+			<a href="/private/">Private</a> <a href="/logout/">Logout</a> <a href="`+other.URL+`/">Other</a>
+			<a href="mailto:bot@example.com">Mail</a> <iframe src="/frame/"></iframe>`).
+		Page("/a/", `<a href="/">Home</a> <a href="/deep/1">Deep</a>`).
+		Page("/b", `<a href="/a/">A</a>`).
+		Page("/frame/", "FRAME").
+		Page("/deep/1", `<a href="/deep/2">Deep</a>`).
+		Page("/deep/2", `<a href="/deep/3">Deep</a>`).
+		Page("/deep/3", "DEEP").
+		Page("/logout/", "BYE").
+		Login("/login/", nil).
+		Private("/private/", "PRIVATE")
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	if _, err := b.POST("/login/", nil); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		mu      sync.Mutex
+		visited []string
+	)
+	c := NewCrawler(b, func(page *Page, depth int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		visited = append(visited, page.URL().RequestURI())
+		return nil
+	})
+	c.Scope.Exclude = []*regexp.Regexp{regexp.MustCompile(`/logout/`)}
+	c.Scope.MaxDepth = 3
+	c.OnError = func(url string, err error) {
+		t.Errorf("Unexpected error loading %s: %v", url, err)
+	}
+	if err := c.Run(context.Background(), "/"); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(visited)
+	want := "/,/a/,/b?x=2&y=1,/deep/1,/deep/2,/frame/,/private/"
+	if got := strings.Join(visited, ","); got != want {
+		t.Errorf("Unexpected pages visited:\n%s, want\n%s", got, want)
+	}
+	s.AssertHeader(t, "/deep/1", "Referer", s.URL+"/a/")
+
+	// Handler errors stop the crawl
+	stop := errors.New("stop")
+	c = NewCrawler(b, func(page *Page, depth int) error { return stop })
+	if err := c.Run(context.Background(), "/"); err != stop {
+		t.Errorf("Expected the handler error, got %v", err)
+	}
+
+	// Links are not followed with ErrSkipLinks
+	var count int
+	c = NewCrawler(b, func(page *Page, depth int) error {
+		count++
+		return ErrSkipLinks
+	})
+	c.Workers = 1
+	if err := c.Run(context.Background(), "/", "/a/"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 pages, got %d", count)
+	}
+	// Seeds are not sent with the Referer of the last page loaded
+	s.AssertHeader(t, "/a/", "Referer", "")
+}
+
+// closeTracker counts the response bodies not closed yet.
+type closeTracker struct {
+	io.ReadCloser
+	open   *int32
+	closed int32
+}
+
+func (c *closeTracker) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		atomic.AddInt32(c.open, -1)
+	}
+	return c.ReadCloser.Close()
+}
+
+func TestCrawlerClosesBodies(t *testing.T) {
+	s := bottest.NewSite().
+		Page("/", `<a href="/skip/">Skip</a> <a href="/file.txt">File</a> <a href="/home">Home</a> <a href="/fail/">Fail</a>`).
+		Page("/skip/", `<a href="/">Home</a>`).
+		HandleFunc("/file.txt", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "FILE")
+		}).
+		HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/", http.StatusFound)
+		}).
+		Page("/fail/", "FAIL")
+	defer s.Close()
+
+	var open int32
+	b := New().BaseURL(s.URL).Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(r)
+			if err == nil {
+				atomic.AddInt32(&open, 1)
+				resp.Body = &closeTracker{ReadCloser: resp.Body, open: &open}
+			}
+			return resp, err
+		})
+	})
+	fail := errors.New("fail")
+	c := NewCrawler(b, func(page *Page, depth int) error {
+		switch page.URL().Path {
+		case "/skip/":
+			return ErrSkipLinks
+		case "/fail/":
+			return fail
+		}
+		return nil
+	})
+	c.Workers = 1
+	if err := c.Run(context.Background(), "/"); err != fail {
+		t.Errorf("Expected the handler error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&open); n != 0 {
+		t.Errorf("Expected all response bodies closed, %d still open", n)
+	}
+}
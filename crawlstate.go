@@ -0,0 +1,177 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+// ErrNoCrawlState is returned by Resume when the store has no state.
+var ErrNoCrawlState = errors.New("bot: no crawl state to resume")
+
+// CrawlState is a snapshot of a crawl, saved by the Crawler to resume it
+// later, possibly in another process.
+type CrawlState struct {
+	// Seeds are the normalized seed URLs.
+	Seeds []string `json:"seeds"`
+
+	// Queue is the frontier: the URLs not visited yet, including the
+	// ones being loaded when the snapshot was taken.
+	Queue []CrawlEntry `json:"queue"`
+
+	// Visited are the URLs already visited, with their status.
+	Visited []CrawlEntry `json:"visited"`
+
+	// Cookies are the session cookies, in the format of EncodeCookies,
+	// with their attributes, such as Path and Expires, by the URL that
+	// set them.
+	Cookies json.RawMessage `json:"cookies,omitempty"`
+}
+
+// StateStore saves and loads the crawl state.
+type StateStore interface {
+	// Load returns the last state saved, or nil if there is none.
+	Load() (*CrawlState, error)
+
+	// Save replaces the state saved.
+	Save(state *CrawlState) error
+}
+
+// FileStore is a StateStore that saves the state as JSON to a file.
+// The file is replaced atomically, so a crash while saving keeps the
+// previous checkpoint.
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore returns a FileStore that saves the state to path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load reads the state from the file. A missing file means no state.
+func (f *FileStore) Load() (*CrawlState, error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := new(CrawlState)
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Save writes the state to the file.
+func (f *FileStore) Save(state *CrawlState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(f.Path, b)
+}
+
+// State returns a snapshot of the crawl. Pages being loaded are
+// part of the Queue, so they are visited again when resuming.
+func (c *Crawler) State() (*CrawlState, error) {
+	c.mu.Lock()
+	state := &CrawlState{
+		Seeds:   append([]string(nil), c.seeds...),
+		Queue:   make([]CrawlEntry, 0, len(c.inflight)+len(c.queue)),
+		Visited: append([]CrawlEntry(nil), c.visited...),
+	}
+	for _, entry := range c.inflight {
+		state.Queue = append(state.Queue, entry)
+	}
+	state.Queue = append(state.Queue, c.queue...)
+	c.mu.Unlock()
+
+	cookies, err := c.encodeCookies()
+	if err != nil {
+		return nil, err
+	}
+	state.Cookies = cookies
+	return state, nil
+}
+
+// encodeCookies encodes the cookies set through the Bot, with all their
+// attributes, so the session is restored as it was.
+func (c *Crawler) encodeCookies() ([]byte, error) {
+	if r, ok := c.bot.j.(*cookieRecorder); ok {
+		return json.Marshal(r.jar())
+	}
+	return c.bot.EncodeCookies()
+}
+
+// Checkpoint saves the crawl state to the Store.
+func (c *Crawler) Checkpoint() error {
+	if c.Store == nil {
+		return nil
+	}
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	state, err := c.State()
+	if err != nil {
+		return err
+	}
+	if err := c.Store.Save(state); err != nil {
+		return err
+	}
+	c.bot.log().Debug("crawl checkpoint", "queue", len(state.Queue), "visited", len(state.Visited))
+	return nil
+}
+
+// Resume continues the crawl saved in the Store, as Run does. The saved
+// cookies are restored into the Bot cookie jar, URLs already visited are
+// not visited again, and the frontier is loaded in the order saved.
+func (c *Crawler) Resume(ctx context.Context) error {
+	if c.Store == nil {
+		return ErrNoCrawlState
+	}
+	state, err := c.Store.Load()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return ErrNoCrawlState
+	}
+	if len(state.Cookies) > 0 {
+		if err := c.bot.DecodeCookies(state.Cookies); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	c.seeds = append(c.seeds, state.Seeds...)
+	for _, entry := range state.Visited {
+		c.seen[entry.URL] = true
+		if entry.Final != "" {
+			c.seen[entry.Final] = true
+		}
+		c.visited = append(c.visited, entry)
+	}
+	for _, entry := range state.Queue {
+		if !c.seen[entry.URL] {
+			c.seen[entry.URL] = true
+			c.queue = append(c.queue, entry)
+		}
+	}
+	queued, visited := len(c.queue), len(c.visited)
+	c.mu.Unlock()
+	c.bot.log().Info("crawl resumed", "queue", queued, "visited", visited)
+	return c.run(ctx)
+}
+
+// Visited returns the URLs visited so far, with their status.
+func (c *Crawler) Visited() []CrawlEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]CrawlEntry(nil), c.visited...)
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestCrawlStateResume(t *testing.T) {
+	s := bottest.NewSite().
+		Page("/", `<a href="/a/">A</a> <a href="/missing/">Missing</a>`).
+		Page("/a/", `<a href="/b/">B</a>`).
+		Page("/b/", `<a href="/private/">Private</a>`).
+		Error("/missing/", http.StatusNotFound, "Not Found").
+		Login("/login/", nil).
+		Private("/private/", `<a href="/">Home</a>`).
+		HandleFunc("/app/login", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Set-Cookie", "JSESSIONID=s1; Path=/app; Max-Age=3600; HttpOnly")
+		})
+	defer s.Close()
+
+	store := NewFileStore(filepath.Join(t.TempDir(), "crawl.json"))
+	b := New().BaseURL(s.URL)
+	if _, err := b.POST("/login/", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GET("/app/login"); err != nil {
+		t.Fatal(err)
+	}
+	var visited []string
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewCrawler(b, func(page *Page, depth int) error {
+		visited = append(visited, page.URL().Path)
+		if len(visited) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	c.Workers = 1
+	c.Store = store
+	c.OnError = func(string, error) {}
+	if err := c.Run(ctx, "/"); err != context.Canceled {
+		t.Fatalf("Expected the crawl to be canceled, got %v", err)
+	}
+	state, err := store.Load()
+	if err != nil || state == nil {
+		t.Fatalf("Unable to load the state: %v, %v", state, err)
+	}
+	if len(state.Queue) == 0 || len(state.Cookies) == 0 {
+		t.Errorf("Unexpected state saved: %+v", state)
+	}
+
+	// A new Bot resumes the crawl with the saved session.
+	b = New()
+	c = NewCrawler(b, func(page *Page, depth int) error {
+		visited = append(visited, page.URL().Path)
+		return nil
+	})
+	c.Workers = 1
+	c.Store = store
+	c.OnError = func(string, error) {}
+	if err := c.Resume(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(visited)
+	want := "/,/a/,/b/,/private/"
+	if got := strings.Join(visited, ","); got != want {
+		t.Errorf("Unexpected pages visited:\n%s, want\n%s", got, want)
+	}
+	status := make(map[string]int)
+	for _, entry := range c.Visited() {
+		status[strings.TrimPrefix(entry.URL, s.URL)] = entry.Status
+	}
+	if status["/missing/"] != http.StatusNotFound || status["/private/"] != http.StatusOK {
+		t.Errorf("Unexpected status recorded: %v", status)
+	}
+	if state, _ = store.Load(); len(state.Queue) != 0 || len(state.Visited) != 5 {
+		t.Errorf("Unexpected final state: %d queued, %d visited", len(state.Queue), len(state.Visited))
+	}
+	// Cookies are saved once, with their attributes.
+	var jar CookieJar
+	if err := json.Unmarshal(state.Cookies, &jar); err != nil {
+		t.Fatal(err)
+	}
+	if len(jar.Data) != 2 || len(jar.Data[s.URL+"/login/"]) != 1 {
+		t.Errorf("Unexpected cookies saved: %s", state.Cookies)
+	}
+	if c := jar.Data[s.URL+"/app/login"]; len(c) != 1 || c[0].Path != "/app" || c[0].Expires.IsZero() || !c[0].HttpOnly {
+		t.Errorf("Unexpected session cookie saved: %s", state.Cookies)
+	}
+	u, _ := url.Parse(s.URL + "/app/home")
+	if c := b.j.Cookies(u); len(c) != 2 {
+		t.Errorf("Expected the session cookies restored in %v, got %v", u, c)
+	}
+	u, _ = url.Parse(s.URL + "/")
+	if c := b.j.Cookies(u); len(c) != 1 {
+		t.Errorf("Expected only the login cookie in %v, got %v", u, c)
+	}
+
+	// Resume fails without a state.
+	c = NewCrawler(b, nil)
+	c.Store = NewFileStore(filepath.Join(t.TempDir(), "none.json"))
+	if err := c.Resume(context.Background()); err != ErrNoCrawlState {
+		t.Errorf("Expected ErrNoCrawlState, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// CSRF describes where a web framework puts the anti-CSRF token in
+// pages, and how the token is sent back.
+type CSRF struct {
+	// Field is the name of the hidden input with the token. The token
+	// is also sent in this field, in URL encoded form posts.
+	Field string
+
+	// Meta is the name of the <meta> tag with the token.
+	Meta string
+
+	// Cookie is the name of the cookie with the token.
+	// When set, the cookie takes precedence over the page token.
+	Cookie string
+
+	// Header is the request header used to send the token.
+	// Responses with this header also refresh the token.
+	Header string
+}
+
+var (
+	// CSRFDjango is the Django CSRF protection.
+	CSRFDjango = CSRF{Field: "csrfmiddlewaretoken", Cookie: "csrftoken", Header: "X-CSRFToken"}
+
+	// CSRFRails is the Ruby on Rails authenticity token.
+	CSRFRails = CSRF{Field: "authenticity_token", Meta: "csrf-token", Header: "X-CSRF-Token"}
+
+	// CSRFLaravel is the Laravel CSRF protection.
+	CSRFLaravel = CSRF{Field: "_token", Meta: "csrf-token", Header: "X-CSRF-TOKEN"}
+
+	// CSRFASPNET is the ASP.NET anti-forgery token.
+	CSRFASPNET = CSRF{Field: "__RequestVerificationToken", Header: "RequestVerificationToken"}
+)
+
+// csrfState holds the CSRF rule and the tokens found so far.
+type csrfState struct {
+	rule CSRF
+
+	mu sync.Mutex
+	// tokens are indexed by origin.
+	tokens map[string]string
+}
+
+// UseCSRF makes the Bot extract anti-CSRF tokens from the pages it
+// loads, as described by rule, and send them in requests other than
+// GET, HEAD, OPTIONS and TRACE to the same origin. Tokens are refreshed
+// by each page, or response header, that contains a new one.
+//
+// Tokens are sent as headers, and as form fields in URL encoded form
+// posts that do not have the field yet. Only one rule is used, such as
+// CSRFDjango, because frameworks share the names of their tokens, and
+// sending the fields of other frameworks may be rejected.
+func (bot *Bot) UseCSRF(rule CSRF) *Bot {
+	bot.csrf = &csrfState{
+		rule:   rule,
+		tokens: make(map[string]string),
+	}
+	return bot
+}
+
+// extract updates the tokens with the ones found in page.
+func (c *csrfState) extract(page *Page) {
+	u := page.URL()
+	if u == nil {
+		return
+	}
+	rule := c.rule
+	var found string
+	if rule.Header != "" {
+		found = page.resp.Header.Get(rule.Header)
+	}
+	ct, _, _ := mime.ParseMediaType(page.resp.Header.Get("Content-Type"))
+	if found == "" && (ct == "text/html" || ct == "application/xhtml+xml") {
+		body, err := page.Bytes()
+		if err != nil {
+			return
+		}
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		if rule.Field != "" {
+			found = doc.Find(`input[name="`+rule.Field+`"]`).First().AttrOr("value", "")
+		}
+		if found == "" && rule.Meta != "" {
+			found = doc.Find(`meta[name="`+rule.Meta+`"]`).First().AttrOr("content", "")
+		}
+	}
+	if found == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := origin(u)
+	if found != c.tokens[o] {
+		page.log().Debug("csrf token found", "url", u.String(), "field", rule.Field)
+		c.tokens[o] = found
+	}
+}
+
+// token returns the token to be sent to u.
+func (c *csrfState) token(bot *Bot, u *url.URL) string {
+	if name := c.rule.Cookie; name != "" {
+		for _, cookie := range bot.j.Cookies(u) {
+			if cookie.Name == name {
+				return cookie.Value
+			}
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[origin(u)]
+}
+
+// injectCSRF sends the anti-CSRF tokens in unsafe requests.
+func (bot *Bot) injectCSRF(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		c := bot.csrf
+		if c == nil {
+			return next.RoundTrip(r)
+		}
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS", "TRACE":
+			return next.RoundTrip(r)
+		}
+		token := c.token(bot, r.URL)
+		if token == "" {
+			return next.RoundTrip(r)
+		}
+		r = r.Clone(r.Context())
+		if h := c.rule.Header; h != "" && r.Header.Get(h) == "" {
+			r.Header.Set(h, token)
+		}
+		if f := c.rule.Field; f != "" {
+			if err := addFormFields(r, url.Values{f: {token}}); err != nil {
+				bot.log().Warn("unable to add csrf token", "url", r.URL.String(), "err", err)
+			}
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+// addFormFields appends to the body of the URL encoded form post r
+// the fields it does not have yet.
+func addFormFields(r *http.Request, fields url.Values) error {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct != "application/x-www-form-urlencoded" {
+		return nil
+	}
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		rc := r.Body
+		if r.GetBody != nil {
+			b, err := r.GetBody()
+			if err != nil {
+				return err
+			}
+			rc = b
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		body = b
+		if r.GetBody == nil {
+			// The body was consumed, so restore it in case the
+			// fields can't be added.
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+	var extra []string
+	for name := range fields {
+		if _, ok := form[name]; !ok {
+			extra = append(extra, url.QueryEscape(name)+"="+url.QueryEscape(fields.Get(name)))
+		}
+	}
+	sort.Strings(extra)
+	if len(body) > 0 && len(extra) > 0 {
+		body = append(body, '&')
+	}
+	body = append(body, strings.Join(extra, "&")...)
+	if r.Body != nil {
+		// The transport only closes the body it sends.
+		r.Body.Close()
+	}
+	r.ContentLength = int64(len(body))
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil
+}
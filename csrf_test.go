@@ -0,0 +1,116 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestCSRF(t *testing.T) {
+	token := 0
+	s := bottest.NewSite().
+		HandleFunc("/form/", func(w http.ResponseWriter, r *http.Request) {
+			token++
+			fmt.Fprintf(w, `<html><head><meta name="csrf-token" content="t%d"></head><body>
+				<form method="post" action="/form/"><input type="hidden" name="_token" value="t%d"></form>
+				</body></html>`, token, token)
+		}).
+		HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{}`)
+		})
+	defer s.Close()
+	other := bottest.NewSite().Page("/", "OTHER")
+	defer other.Close()
+
+	b := New().BaseURL(s.URL).UseCSRF(CSRFLaravel)
+	if _, err := b.GET("/form/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.POST("/form/", url.Values{"name": {"value"}}); err != nil {
+		t.Fatal(err)
+	}
+	s.AssertSubmitted(t, "/form/", url.Values{"name": {"value"}, "_token": {"t1"}, "authenticity_token": nil})
+	s.AssertHeader(t, "/form/", "X-Csrf-Token", "t1")
+
+	// The token is rotated by the response, and kept by pages without it
+	if _, err := b.GET("/api/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.POST("/api/", url.Values{"_token": {"mine"}}); err != nil {
+		t.Fatal(err)
+	}
+	s.AssertSubmitted(t, "/api/", url.Values{"_token": {"mine"}})
+	s.AssertHeader(t, "/api/", "X-Csrf-Token", "t2")
+
+	// Tokens are not sent to other origins
+	req, _ := http.NewRequest("POST", other.URL+"/", nil)
+	if _, err := b.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	other.AssertHeader(t, "/", "X-Csrf-Token", "")
+	other.AssertSubmitted(t, "/", url.Values{"_token": nil})
+}
+
+func TestCSRFCookie(t *testing.T) {
+	s := bottest.NewSite().
+		HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "csrftoken", Value: "secret", Path: "/"})
+			fmt.Fprint(w, `<html><form><input type="hidden" name="csrfmiddlewaretoken" value="masked"></form></html>`)
+		})
+	defer s.Close()
+
+	b := New().BaseURL(s.URL).UseCSRF(CSRFDjango)
+	if _, err := b.GET("/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.POST("/", url.Values{"csrfmiddlewaretoken": {"masked"}}); err != nil {
+		t.Fatal(err)
+	}
+	s.AssertHeader(t, "/", "X-CSRFToken", "secret")
+	s.AssertSubmitted(t, "/", url.Values{"csrfmiddlewaretoken": {"masked"}})
+}
+
+func TestAddFormFieldsInvalidBody(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Body = io.NopCloser(strings.NewReader("a=1;b=2"))
+	if err := addFormFields(req, url.Values{"_token": {"t1"}}); err == nil {
+		t.Errorf("addFormFields should fail with an invalid body")
+	}
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a=1;b=2" {
+		t.Errorf("body = %q, want it unchanged", b)
+	}
+}
+
+func TestAddFormFieldsClosesBody(t *testing.T) {
+	var open int32 = 1
+	body := &closeTracker{ReadCloser: io.NopCloser(strings.NewReader("a=1")), open: &open}
+	req, _ := http.NewRequest("POST", "http://example.com/", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("a=1")), nil
+	}
+	if err := addFormFields(req, url.Values{"_token": {"t1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if open != 0 {
+		t.Errorf("Expected the original body to be closed")
+	}
+	b, _ := io.ReadAll(req.Body)
+	if string(b) != "a=1&_token=t1" {
+		t.Errorf("body = %q, want %q", b, "a=1&_token=t1")
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// redacted is the placeholder written in place of sensitive values.
+const redacted = "[REDACTED]"
+
+var (
+	// DefaultRedactHeaders are the headers redacted when
+	// DumpConfig.RedactHeaders is nil.
+	DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+	// defaultDump is used when debugging is enabled with Bot.Debug
+	// and no DumpConfig was provided with Bot.Dump.
+	defaultDump = &DumpConfig{}
+)
+
+// DumpConfig controls how requests and responses are dumped for debugging.
+// Sensitive headers and form fields are redacted from the output.
+type DumpConfig struct {
+	// Output receives the dumps. If both Output and Dir are unset,
+	// dumps are logged at the debug level using the Bot logger.
+	Output io.Writer
+
+	// Dir, when set, makes each request and its response to be
+	// written to their own file inside this directory.
+	Dir string
+
+	// RedactHeaders lists the headers with values to be redacted.
+	// If nil, DefaultRedactHeaders is used.
+	// Cookie names are preserved, only their values are redacted.
+	RedactHeaders []string
+
+	// RedactFields lists form field names with values to be redacted.
+	// Password inputs found by Page.Forms are always redacted.
+	RedactFields []string
+
+	// BodyLimit is the maximum number of bytes dumped from the response body.
+	// Zero means the response body is not dumped, and a negative value
+	// means that the full body is dumped.
+	BodyLimit int
+
+	seq int64
+}
+
+// Dump enables dumping requests and responses using the provided config.
+// Use nil to disable dumping, or to use the defaults when Debug is enabled.
+func (bot *Bot) Dump(cfg *DumpConfig) *Bot {
+	bot.dump = cfg
+	return bot
+}
+
+// dumper returns the dump configuration in use, or nil if
+// dumping is disabled.
+func (bot *Bot) dumper() *DumpConfig {
+	if bot.dump != nil {
+		return bot.dump
+	}
+	if bot.debug {
+		return defaultDump
+	}
+	return nil
+}
+
+// redactField marks the form field name as sensitive, so its
+// value is redacted in dumps.
+func (bot *Bot) redactField(name string) {
+	if bot == nil || bot.secrets == nil || name == "" {
+		return
+	}
+	bot.secrets.Store(name, true)
+}
+
+// isSecretField returns true if the form field value must be redacted.
+func (bot *Bot) isSecretField(cfg *DumpConfig, name string) bool {
+	if _, ok := bot.secrets.Load(name); ok {
+		return true
+	}
+	for _, f := range cfg.RedactFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// redactBody returns a copy of the form body with the values of the
+// secret fields redacted. Other bodies are returned as is.
+func (bot *Bot) redactBody(cfg *DumpConfig, contentType string, body []byte) []byte {
+	if !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return body
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return body
+	}
+	for k := range form {
+		if bot.isSecretField(cfg, k) {
+			for i := range form[k] {
+				form[k][i] = redacted
+			}
+		}
+	}
+	return []byte(form.Encode())
+}
+
+// open returns the writer for the dump of the request r.
+// The returned function must be called to release the writer.
+func (cfg *DumpConfig) open(bot *Bot, r *http.Request) (io.Writer, func(), error) {
+	switch {
+	case cfg.Dir != "":
+		n := atomic.AddInt64(&cfg.seq, 1)
+		name := fmt.Sprintf("%04d-%s-%s.txt", n, r.Method, strings.Replace(r.URL.Host, ":", "_", -1))
+		f, err := os.Create(filepath.Join(cfg.Dir, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, func() { f.Close() }, nil
+	case cfg.Output != nil:
+		return cfg.Output, func() {}, nil
+	}
+	var buff bytes.Buffer
+	return &buff, func() { bot.log().Debug("dump", "method", r.Method, "url", r.URL.String(), "dump", buff.String()) }, nil
+}
+
+// redactHeaders returns a copy of h with the sensitive values redacted.
+func (cfg *DumpConfig) redactHeaders(h http.Header) http.Header {
+	names := cfg.RedactHeaders
+	if names == nil {
+		names = DefaultRedactHeaders
+	}
+	h = h.Clone()
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		values := h[name]
+		for i, v := range values {
+			switch name {
+			case "Cookie":
+				values[i] = redactCookie(v)
+			case "Set-Cookie":
+				values[i] = redactSetCookie(v)
+			default:
+				values[i] = redacted
+			}
+		}
+	}
+	return h
+}
+
+// redactCookie redacts the cookie values in a Cookie header.
+func redactCookie(v string) string {
+	parts := strings.Split(v, ";")
+	for i, p := range parts {
+		name := strings.SplitN(strings.TrimSpace(p), "=", 2)[0]
+		parts[i] = name + "=" + redacted
+	}
+	return strings.Join(parts, "; ")
+}
+
+// redactSetCookie redacts the cookie value in a Set-Cookie header,
+// keeping the cookie name and attributes.
+func redactSetCookie(v string) string {
+	attrs := ""
+	if i := strings.Index(v, ";"); i >= 0 {
+		v, attrs = v[:i], v[i:]
+	}
+	name := strings.SplitN(strings.TrimSpace(v), "=", 2)[0]
+	return name + "=" + redacted + attrs
+}
+
+// dumpRequest writes the redacted request to w.
+// The request body is preserved, so it can be sent afterwards.
+func (cfg *DumpConfig) dumpRequest(w io.Writer, bot *Bot, r *http.Request) error {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	body = bot.redactBody(cfg, r.Header.Get("Content-Type"), body)
+	// The dump performs a fake round trip, so it must not
+	// report to any httptrace.ClientTrace from the request context.
+	out := r.Clone(context.Background())
+	out.Header = cfg.redactHeaders(r.Header)
+	out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	b, err := httputil.DumpRequestOut(out, true)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// dumpResponse writes the redacted response to w.
+// At most cfg.BodyLimit bytes of the body are written, and the
+// response body is preserved so it can be read afterwards.
+func (cfg *DumpConfig) dumpResponse(w io.Writer, resp *http.Response) error {
+	out := *resp
+	out.Header = cfg.redactHeaders(resp.Header)
+	b, err := httputil.DumpResponse(&out, false)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if cfg.BodyLimit == 0 || resp.Body == nil {
+		return nil
+	}
+	var head []byte
+	if cfg.BodyLimit < 0 {
+		head, err = ioutil.ReadAll(resp.Body)
+	} else {
+		head, err = ioutil.ReadAll(io.LimitReader(resp.Body, int64(cfg.BodyLimit)))
+	}
+	resp.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(head), resp.Body), Closer: resp.Body}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", head)
+	return err
+}
+
+// replayBody is a response body that replays the bytes already
+// consumed before reading the remaining data.
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestDumpRedacted(t *testing.T) {
+	site := bottest.NewSite().
+		Login("/login", url.Values{"user": {"ronoaldo"}, "password": {"hunter2"}}).
+		Private("/long", "<p>"+strings.Repeat("x", 100)+"</p>")
+	defer site.Close()
+
+	var buff bytes.Buffer
+	b := New().Dump(&DumpConfig{Output: &buff, BodyLimit: 16, RedactFields: []string{"pin"}})
+	page, err := b.GET(site.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := page.Forms(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.POST(site.URL+"/login", url.Values{"user": {"ronoaldo"}, "password": {"hunter2"}, "pin": {"1234"}}); err != nil {
+		t.Fatal(err)
+	}
+	if page, err = b.GET(site.URL + "/long"); err != nil {
+		t.Fatal(err)
+	}
+	body, err := page.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(body, []byte("</p>")) {
+		t.Errorf("Response body was truncated by the dump: %s", body)
+	}
+	sub, _ := site.LastSubmission("/long")
+	if len(sub.Cookies) != 1 {
+		t.Fatalf("Expected session cookie in request, got %v", sub.Cookies)
+	}
+
+	dump := buff.String()
+	t.Logf("Dump:\n%s", dump)
+	for _, secret := range []string{"hunter2", "1234", sub.Cookies[0].Value, strings.Repeat("x", 17)} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("Dump should not contain %q", secret)
+		}
+	}
+	for _, expected := range []string{"user=ronoaldo", bottest.SessionCookie + "=" + redacted, "password=" + url.QueryEscape(redacted)} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("Dump should contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrNotFeed is returned when a document is not an RSS or Atom feed.
+var ErrNotFeed = errors.New("bot: not an RSS or Atom feed")
+
+const (
+	atomNS    = "http://www.w3.org/2005/Atom"
+	contentNS = "http://purl.org/rss/1.0/modules/content/"
+	dcNS      = "http://purl.org/dc/elements/1.1/"
+)
+
+// Feed is an RSS 2.0 channel or an Atom feed.
+type Feed struct {
+	Title       string
+	Link        string
+	Description string
+
+	// Updated is the last time the feed changed,
+	// or the zero time if not informed.
+	Updated time.Time
+
+	Items []FeedItem
+}
+
+// FeedItem is an RSS item or an Atom entry.
+type FeedItem struct {
+	// ID is the RSS guid or the Atom id.
+	ID    string
+	Title string
+	Link  string
+
+	// Summary is the RSS description or the Atom summary, and Content
+	// is the RSS content:encoded or the Atom content. Both may be HTML.
+	Summary string
+	Content string
+
+	Author     string
+	Categories []string
+
+	// Published and Updated are the zero time if not informed.
+	// RSS items only have Published.
+	Published time.Time
+	Updated   time.Time
+}
+
+// xmlLink is an RSS <link>, or an Atom <link> in any feed.
+type xmlLink struct {
+	XMLName xml.Name
+	Rel     string `xml:"rel,attr"`
+	Href    string `xml:"href,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// rssFeed is an RSS 2.0 document.
+type rssFeed struct {
+	Channel struct {
+		Title         string    `xml:"title"`
+		Links         []xmlLink `xml:"link"`
+		Description   string    `xml:"description"`
+		PubDate       string    `xml:"pubDate"`
+		LastBuildDate string    `xml:"lastBuildDate"`
+		Items         []struct {
+			GUID        string    `xml:"guid"`
+			Title       string    `xml:"title"`
+			Links       []xmlLink `xml:"link"`
+			Description string    `xml:"description"`
+			Content     string    `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+			Author      string    `xml:"author"`
+			Creator     string    `xml:"http://purl.org/dc/elements/1.1/ creator"`
+			Categories  []string  `xml:"category"`
+			PubDate     string    `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// atomText is an Atom text construct.
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// atomFeed is an Atom document.
+type atomFeed struct {
+	Title    atomText  `xml:"title"`
+	Subtitle atomText  `xml:"subtitle"`
+	Links    []xmlLink `xml:"link"`
+	Updated  string    `xml:"updated"`
+	Author   struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Entries []struct {
+		ID      string    `xml:"id"`
+		Title   atomText  `xml:"title"`
+		Links   []xmlLink `xml:"link"`
+		Summary atomText  `xml:"summary"`
+		Content atomText  `xml:"content"`
+		Author  struct {
+			Name string `xml:"name"`
+		} `xml:"author"`
+		Categories []struct {
+			Term string `xml:"term,attr"`
+		} `xml:"category"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// ParseFeed parses an RSS 2.0 or Atom document, gzipped or not.
+// Relative links are kept as is.
+func ParseFeed(b []byte) (*Feed, error) {
+	b, err := gunzip(b)
+	if err != nil {
+		return nil, err
+	}
+	root, err := xmlRoot(b)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case root.Local == "rss":
+		return parseRSS(b)
+	case root.Local == "feed" && root.Space == atomNS:
+		return parseAtom(b)
+	}
+	return nil, ErrNotFeed
+}
+
+// xmlRoot returns the name of the root element of the document.
+func xmlRoot(b []byte) (xml.Name, error) {
+	d := newXMLDecoder(b)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return xml.Name{}, ErrNotFeed
+		}
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+func parseRSS(b []byte) (*Feed, error) {
+	var rss rssFeed
+	if err := newXMLDecoder(b).Decode(&rss); err != nil {
+		return nil, err
+	}
+	ch := rss.Channel
+	feed := &Feed{
+		Title:       strings.TrimSpace(ch.Title),
+		Link:        rssLink(ch.Links),
+		Description: strings.TrimSpace(ch.Description),
+		Updated:     feedTime(ch.LastBuildDate),
+	}
+	if feed.Updated.IsZero() {
+		feed.Updated = feedTime(ch.PubDate)
+	}
+	for _, it := range ch.Items {
+		item := FeedItem{
+			ID:        strings.TrimSpace(it.GUID),
+			Title:     strings.TrimSpace(it.Title),
+			Link:      rssLink(it.Links),
+			Summary:   strings.TrimSpace(it.Description),
+			Content:   strings.TrimSpace(it.Content),
+			Author:    strings.TrimSpace(it.Author),
+			Published: feedTime(it.PubDate),
+		}
+		if item.Author == "" {
+			item.Author = strings.TrimSpace(it.Creator)
+		}
+		for _, c := range it.Categories {
+			item.Categories = append(item.Categories, strings.TrimSpace(c))
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
+
+func parseAtom(b []byte) (*Feed, error) {
+	var atom atomFeed
+	if err := newXMLDecoder(b).Decode(&atom); err != nil {
+		return nil, err
+	}
+	feed := &Feed{
+		Title:       atom.Title.String(),
+		Link:        atomLink(atom.Links),
+		Description: atom.Subtitle.String(),
+		Updated:     feedTime(atom.Updated),
+	}
+	for _, e := range atom.Entries {
+		item := FeedItem{
+			ID:        strings.TrimSpace(e.ID),
+			Title:     e.Title.String(),
+			Link:      atomLink(e.Links),
+			Summary:   e.Summary.String(),
+			Content:   e.Content.String(),
+			Author:    strings.TrimSpace(e.Author.Name),
+			Published: feedTime(e.Published),
+			Updated:   feedTime(e.Updated),
+		}
+		if item.Author == "" {
+			item.Author = strings.TrimSpace(atom.Author.Name)
+		}
+		for _, c := range e.Categories {
+			item.Categories = append(item.Categories, c.Term)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
+
+// rssLink returns the RSS <link> text, ignoring atom:link elements
+// that are usually added to RSS channels.
+func rssLink(links []xmlLink) string {
+	for _, l := range links {
+		if l.XMLName.Space != atomNS && strings.TrimSpace(l.Text) != "" {
+			return strings.TrimSpace(l.Text)
+		}
+	}
+	return ""
+}
+
+// atomLink returns the alternate link href.
+func atomLink(links []xmlLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+// feedTime parses the time, or returns the zero time.
+func feedTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, _ := parseTime(s)
+	return t
+}
+
+// newXMLDecoder returns a lenient decoder, that accepts Latin-1
+// documents and documents already converted to UTF-8.
+func newXMLDecoder(b []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	valid := utf8.Valid(b)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if valid {
+			return input, nil
+		}
+		switch strings.ToLower(charset) {
+		case "iso-8859-1", "latin1", "latin-1", "windows-1252", "us-ascii":
+			data, err := ioutil.ReadAll(input)
+			if err != nil {
+				return nil, err
+			}
+			r := make([]rune, len(data))
+			for i, c := range data {
+				r[i] = rune(c)
+			}
+			return strings.NewReader(string(r)), nil
+		}
+		return nil, errors.New("bot: unsupported charset: " + charset)
+	}
+	return d
+}
+
+// Feed loads and parses the RSS or Atom feed at the URL. Relative links
+// are resolved against the feed URL. The URL is prefixed with the Bot
+// BaseURL, as in GET.
+func (bot *Bot) Feed(url string) (*Feed, error) {
+	page, err := bot.GET(url)
+	if err != nil {
+		return nil, err
+	}
+	body, err := page.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	feed, err := ParseFeed(body)
+	if err != nil {
+		return nil, err
+	}
+	base := page.URL()
+	feed.Link = resolveLink(base, feed.Link)
+	for i := range feed.Items {
+		feed.Items[i].Link = resolveLink(base, feed.Items[i].Link)
+	}
+	return feed, nil
+}
+
+// Feeds returns the RSS and Atom feeds advertised in the page with
+// <link rel="alternate"> elements.
+func (page *Page) Feeds() ([]*url.URL, error) {
+	doc, err := page.document()
+	if err != nil {
+		return nil, err
+	}
+	base := page.URL()
+	if base == nil {
+		return nil, errNilResp
+	}
+	var feeds []*url.URL
+	doc.Find(`link[rel~="alternate"][href]`).Each(func(i int, s *goquery.Selection) {
+		switch strings.ToLower(strings.TrimSpace(s.AttrOr("type", ""))) {
+		case "application/rss+xml", "application/atom+xml", "application/feed+xml":
+		default:
+			return
+		}
+		if u, err := base.Parse(strings.TrimSpace(s.AttrOr("href", ""))); err == nil {
+			feeds = append(feeds, u)
+		}
+	})
+	return feeds, nil
+}
+
+// resolveLink resolves the link against base, if possible.
+func resolveLink(base *url.URL, link string) string {
+	if base == nil || link == "" {
+		return link
+	}
+	u, err := base.Parse(link)
+	if err != nil {
+		return link
+	}
+	return u.String()
+}
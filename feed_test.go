@@ -0,0 +1,135 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+const rssDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+	<title>News</title>
+	<atom:link href="http://example.com/rss" rel="self" type="application/rss+xml"/>
+	<link>/news/</link>
+	<description>Latest news</description>
+	<lastBuildDate>Fri, 2 Jan 2015 10:00:00 GMT</lastBuildDate>
+	<item>
+		<title>First &amp; foremost</title>
+		<link>/news/1</link>
+		<guid isPermaLink="false">news-1</guid>
+		<description><![CDATA[<p>Summary</p>]]></description>
+		<content:encoded><![CDATA[<p>Full text</p>]]></content:encoded>
+		<dc:creator>Ronoaldo</dc:creator>
+		<category>go</category>
+		<category>bots</category>
+		<pubDate>Thu, 01 Jan 2015 12:30:00 -0200</pubDate>
+	</item>
+</channel>
+</rss>`
+
+const atomDoc = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title type="text">Blog</title>
+	<subtitle type="html">&lt;b&gt;Posts&lt;/b&gt;</subtitle>
+	<link rel="self" href="http://example.com/atom"/>
+	<link href="http://example.com/"/>
+	<updated>2015-01-02T10:00:00Z</updated>
+	<author><name>Ronoaldo</name></author>
+	<entry>
+		<id>urn:post:1</id>
+		<title>Hello</title>
+		<link rel="alternate" href="http://example.com/1"/>
+		<summary>Short</summary>
+		<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml">Long</div></content>
+		<category term="go"/>
+		<published>2015-01-01T12:00:00Z</published>
+		<updated>2015-01-02T12:00:00Z</updated>
+	</entry>
+</feed>`
+
+func TestParseFeed(t *testing.T) {
+	feed, err := ParseFeed([]byte(rssDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "News" || feed.Link != "/news/" || feed.Description != "Latest news" {
+		t.Errorf("Unexpected RSS channel: %+v", feed)
+	}
+	if !feed.Updated.Equal(time.Date(2015, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected RSS updated time: %v", feed.Updated)
+	}
+	if len(feed.Items) != 1 {
+		t.Fatalf("Expected 1 item, got %d", len(feed.Items))
+	}
+	item := feed.Items[0]
+	if item.ID != "news-1" || item.Title != "First & foremost" || item.Link != "/news/1" ||
+		item.Summary != "<p>Summary</p>" || item.Content != "<p>Full text</p>" || item.Author != "Ronoaldo" ||
+		len(item.Categories) != 2 || item.Categories[1] != "bots" {
+		t.Errorf("Unexpected RSS item: %+v", item)
+	}
+	if !item.Published.Equal(time.Date(2015, 1, 1, 14, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected RSS item published time: %v", item.Published)
+	}
+
+	feed, err = ParseFeed([]byte(atomDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Title != "Blog" || feed.Link != "http://example.com/" || feed.Description != "<b>Posts</b>" {
+		t.Errorf("Unexpected Atom feed: %+v", feed)
+	}
+	if len(feed.Items) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(feed.Items))
+	}
+	item = feed.Items[0]
+	if item.ID != "urn:post:1" || item.Title != "Hello" || item.Link != "http://example.com/1" ||
+		item.Summary != "Short" || item.Content != `<div xmlns="http://www.w3.org/1999/xhtml">Long</div>` ||
+		item.Author != "Ronoaldo" || len(item.Categories) != 1 || item.Categories[0] != "go" {
+		t.Errorf("Unexpected Atom entry: %+v", item)
+	}
+	if !item.Updated.Equal(time.Date(2015, 1, 2, 12, 0, 0, 0, time.UTC)) || item.Published.IsZero() {
+		t.Errorf("Unexpected Atom entry times: %v, %v", item.Published, item.Updated)
+	}
+
+	if _, err := ParseFeed([]byte("<html><body>Hi</body></html>")); err != ErrNotFeed {
+		t.Errorf("Expected ErrNotFeed, got %v", err)
+	}
+}
+
+func TestFeedDiscovery(t *testing.T) {
+	s := bottest.NewSite().
+		Page("/", `<html><head>
+			<link rel="alternate" type="application/rss+xml" href="/rss">
+			<link rel="alternate" type="text/html" href="/other">
+			<link rel="stylesheet" href="/style.css">
+		</head></html>`).
+		Page("/rss", rssDoc)
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	page, err := b.GET("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feeds, err := page.Feeds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].String() != s.URL+"/rss" {
+		t.Fatalf("Unexpected feeds: %v", feeds)
+	}
+	feed, err := b.Feed("/rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Link != s.URL+"/news/" || feed.Items[0].Link != s.URL+"/news/1" {
+		t.Errorf("Expected links to be resolved, got %q and %q", feed.Link, feed.Items[0].Link)
+	}
+}
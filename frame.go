@@ -0,0 +1,90 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrNoFrame is returned by LoadFrame when the page has no frame
+// with the requested name.
+var ErrNoFrame = errors.New("bot: frame not found")
+
+// Frame is a <frame> or <iframe> element in a page.
+type Frame struct {
+	// Name is the frame name attribute, or its id if it has no name.
+	Name string
+
+	// Src is the frame source URL, resolved against the page URL.
+	// It is nil if the frame has no valid src attribute.
+	Src *url.URL
+}
+
+// Frames parses the response body, and returns all the <frame> and
+// <iframe> elements in document order.
+func (page *Page) Frames() ([]Frame, error) {
+	body, err := page.Body()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, err
+	}
+	base := page.URL()
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok && base != nil {
+		if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+			base = u
+		}
+	}
+	var frames []Frame
+	doc.Find("frame, iframe").Each(func(i int, s *goquery.Selection) {
+		f := Frame{Name: s.AttrOr("name", s.AttrOr("id", ""))}
+		src := strings.TrimSpace(s.AttrOr("src", ""))
+		if src != "" {
+			u, err := url.Parse(src)
+			if base != nil && err == nil {
+				u, err = base.Parse(src)
+			}
+			if err != nil {
+				page.log().Warn("parse warning: invalid frame src", "name", f.Name, "src", src, "err", err)
+			} else {
+				f.Src = u
+			}
+		}
+		frames = append(frames, f)
+	})
+	return frames, nil
+}
+
+// LoadFrame loads the content of the frame with the given name in page.
+// The request is sent with the Referer of the page that contains the
+// frame, as a browser does. Nested frames can be loaded by calling
+// LoadFrame with the returned Page.
+func (bot *Bot) LoadFrame(page *Page, name string) (*Page, error) {
+	frames, err := page.Frames()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range frames {
+		if f.Name != name {
+			continue
+		}
+		if f.Src == nil {
+			return nil, fmt.Errorf("bot: frame %q has no src", name)
+		}
+		req, err := http.NewRequestWithContext(bot.context(), "GET", f.Src.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		return bot.Do(withSource(req, &source{url: page.URL(), policy: page.ReferrerPolicy()}))
+	}
+	return nil, fmt.Errorf("%w: %q", ErrNoFrame, name)
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestFrames(t *testing.T) {
+	s := bottest.NewSite().
+		Page("/app/", `<html><frameset cols="20%,80%">
+			<frame name="menu" src="menu.html">
+			<frame name="main" src="/app/main/">
+		</frameset></html>`).
+		Page("/app/menu.html", "MENU").
+		Page("/app/main/", `<html><body><iframe id="content" src="../content/?id=1"></iframe><iframe name="empty"></iframe></body></html>`).
+		Page("/app/content/", "CONTENT")
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	page, err := b.GET("/app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := page.Frames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || frames[0].Name != "menu" || frames[0].Src.String() != s.URL+"/app/menu.html" ||
+		frames[1].Name != "main" || frames[1].Src.String() != s.URL+"/app/main/" {
+		t.Errorf("Unexpected frames: %v", frames)
+	}
+
+	main, err := b.LoadFrame(page, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	menu, err := b.LoadFrame(page, "menu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, menu, "MENU")
+	s.AssertHeader(t, "/app/menu.html", "Referer", s.URL+"/app/")
+
+	// Loading a frame uses the page that contains it as Referer,
+	// instead of the last page, and nested frames are found by id.
+	content, err := b.LoadFrame(main, "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, content, "CONTENT")
+	s.AssertHeader(t, "/app/content/", "Referer", s.URL+"/app/main/")
+
+	if _, err := b.LoadFrame(page, "missing"); !errors.Is(err, ErrNoFrame) {
+		t.Errorf("Expected ErrNoFrame, got %v", err)
+	}
+	if _, err := b.LoadFrame(main, "empty"); err == nil {
+		t.Errorf("Expected an error loading a frame without src")
+	}
+}
@@ -0,0 +1,477 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHARBodyLimit is the maximum number of body bytes recorded
+// by an HARRecorder with no BodyLimit set.
+const DefaultHARBodyLimit = 1 << 20
+
+// HAR is the root of an HTTP Archive 1.2 document.
+// See http://www.softwareishard.com/blog/har-12-spec/ for details.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog holds the recorded entries of an HAR document.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the application that created the HAR document.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request and response pair.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest describes the recorded request.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse describes the recorded response.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARCookie is a cookie sent or received.
+type HARCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Path     string     `json:"path,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	HTTPOnly bool       `json:"httpOnly,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+}
+
+// HARNameValue is a header or query string parameter.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body sent with a request.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent is the body received with a response.
+// Binary bodies are base64 encoded.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are the durations, in milliseconds, of each request phase.
+// Phases that do not apply are set to -1, except Send, Wait and Receive,
+// that are required, and set to 0 when unknown.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARRecorder records all requests and responses of a Bot session
+// as an HTTP Archive, that can be inspected with browser developer tools.
+// It is safe for concurrent use.
+type HARRecorder struct {
+	// BodyLimit is the maximum number of bytes recorded from each
+	// request or response body. If zero, DefaultHARBodyLimit is used.
+	// Use a negative value to disable body recording.
+	BodyLimit int
+
+	mu      sync.Mutex
+	entries []*HAREntry
+}
+
+// NewHARRecorder initializes a new, empty HARRecorder.
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{}
+}
+
+// RecordHAR makes the Bot record every request into rec.
+// Use nil to stop recording.
+func (bot *Bot) RecordHAR(rec *HARRecorder) *Bot {
+	bot.har = rec
+	return bot
+}
+
+// HAR returns the HTTP Archive with the entries recorded so far.
+func (rec *HARRecorder) HAR() *HAR {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	entries := make([]HAREntry, len(rec.entries))
+	for i, e := range rec.entries {
+		entries[i] = *e
+	}
+	return &HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "ronoaldo.gopkg.net/bot", Version: "1.0"},
+			Entries: entries,
+		},
+	}
+}
+
+// WriteTo writes the recorded HTTP Archive as JSON to w.
+func (rec *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(rec.HAR(), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// WriteFile writes the recorded HTTP Archive to the named file.
+func (rec *HARRecorder) WriteFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := rec.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (rec *HARRecorder) bodyLimit() int {
+	if rec.BodyLimit == 0 {
+		return DefaultHARBodyLimit
+	}
+	return rec.BodyLimit
+}
+
+// harTimer collects the request timings using an httptrace.ClientTrace.
+type harTimer struct {
+	mu sync.Mutex
+
+	start, dnsStart, dnsDone, connStart, connDone time.Time
+	tlsStart, tlsDone, gotConn, wrote, firstByte  time.Time
+	remoteAddr                                    string
+}
+
+func (t *harTimer) trace() *httptrace.ClientTrace {
+	// now records the current time into the field pointed by p.
+	now := func(p *time.Time) {
+		t.mu.Lock()
+		*p = time.Now()
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart:         func(string, string) { now(&t.connStart) },
+		ConnectDone:          func(string, string, error) { now(&t.connDone) },
+		TLSHandshakeStart:    func() { now(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wrote) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			now(&t.gotConn)
+			if info.Conn != nil && info.Conn.RemoteAddr() != nil {
+				t.mu.Lock()
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+				t.mu.Unlock()
+			}
+		},
+	}
+}
+
+// serverIP returns the IP address of the server connected to.
+func (t *harTimer) serverIP() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	host, _, err := net.SplitHostPort(t.remoteAddr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// ms returns the duration between the two instants in milliseconds,
+// or -1 if any of them is unknown.
+func ms(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() {
+		return -1
+	}
+	return float64(to.Sub(from)) / float64(time.Millisecond)
+}
+
+// required returns the duration between the two instants in
+// milliseconds, or 0 if any of them is unknown.
+func required(from, to time.Time) float64 {
+	return math.Max(ms(from, to), 0)
+}
+
+func (t *harTimer) timings(done time.Time) HARTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	blocked := t.dnsStart
+	if blocked.IsZero() {
+		blocked = t.connStart
+	}
+	if blocked.IsZero() {
+		blocked = t.gotConn
+	}
+	return HARTimings{
+		Blocked: ms(t.start, blocked),
+		DNS:     ms(t.dnsStart, t.dnsDone),
+		Connect: ms(t.connStart, t.connDone),
+		SSL:     ms(t.tlsStart, t.tlsDone),
+		Send:    required(t.gotConn, t.wrote),
+		Wait:    required(t.wrote, t.firstByte),
+		Receive: required(t.firstByte, done),
+	}
+}
+
+// roundTrip sends the request r using next, recording the
+// request and response as a new entry.
+// The entry is complete when the response body is fully read or closed.
+func (rec *HARRecorder) roundTrip(next http.RoundTripper, r *http.Request) (*http.Response, error) {
+	timer := &harTimer{start: time.Now()}
+	entry := &HAREntry{
+		StartedDateTime: timer.start,
+		Request:         rec.request(r),
+		// Failed requests have an empty response.
+		Response: HARResponse{
+			Cookies:     []HARCookie{},
+			Headers:     []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+	rec.mu.Lock()
+	rec.entries = append(rec.entries, entry)
+	rec.mu.Unlock()
+
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), timer.trace()))
+	resp, err := next.RoundTrip(r)
+	if err != nil {
+		rec.mu.Lock()
+		entry.Comment = err.Error()
+		entry.Timings = timer.timings(time.Now())
+		entry.Time = ms(timer.start, time.Now())
+		rec.mu.Unlock()
+		return resp, err
+	}
+	rec.mu.Lock()
+	entry.ServerIPAddress = timer.serverIP()
+	entry.Response = HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+		Content:     HARContent{Size: -1, MimeType: resp.Header.Get("Content-Type")},
+	}
+	rec.mu.Unlock()
+	resp.Body = &harBody{rc: resp.Body, rec: rec, entry: entry, timer: timer, limit: rec.bodyLimit()}
+	return resp, nil
+}
+
+// request records the request r, preserving its body.
+func (rec *HARRecorder) request(r *http.Request) HARRequest {
+	req := HARRequest{
+		Method:      r.Method,
+		URL:         r.URL.String(),
+		HTTPVersion: r.Proto,
+		Cookies:     harCookies(r.Cookies()),
+		Headers:     harHeaders(r.Header),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+	if req.HTTPVersion == "" {
+		req.HTTPVersion = "HTTP/1.1"
+	}
+	for k, values := range r.URL.Query() {
+		for _, v := range values {
+			req.QueryString = append(req.QueryString, HARNameValue{Name: k, Value: v})
+		}
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return req
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return req
+	}
+	req.BodySize = int64(len(body))
+	if limit := rec.bodyLimit(); limit >= 0 {
+		if len(body) > limit {
+			body = body[:limit]
+		}
+		req.PostData = &HARPostData{
+			MimeType: r.Header.Get("Content-Type"),
+			Text:     string(body),
+		}
+	}
+	return req
+}
+
+// harBody wraps a response body to record its content and timings.
+type harBody struct {
+	rc    io.ReadCloser
+	rec   *HARRecorder
+	entry *HAREntry
+	timer *harTimer
+	limit int
+	buff  bytes.Buffer
+	size  int64
+	once  sync.Once
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	b.size += int64(n)
+	if b.limit >= 0 && b.buff.Len() < b.limit {
+		rest := b.limit - b.buff.Len()
+		if rest > n {
+			rest = n
+		}
+		b.buff.Write(p[:rest])
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	b.finish()
+	return b.rc.Close()
+}
+
+// finish completes the HAR entry with the response body.
+func (b *harBody) finish() {
+	b.once.Do(func() {
+		done := time.Now()
+		b.rec.mu.Lock()
+		defer b.rec.mu.Unlock()
+		e := b.entry
+		e.Timings = b.timer.timings(done)
+		e.Time = ms(b.timer.start, done)
+		e.Response.BodySize = b.size
+		e.Response.Content.Size = b.size
+		if b.limit < 0 {
+			return
+		}
+		if int64(b.buff.Len()) < b.size {
+			e.Response.Content.Comment = "truncated"
+		}
+		if isText(e.Response.Content.MimeType) {
+			e.Response.Content.Text = b.buff.String()
+		} else {
+			e.Response.Content.Text = base64.StdEncoding.EncodeToString(b.buff.Bytes())
+			e.Response.Content.Encoding = "base64"
+		}
+	})
+}
+
+// isText returns true if the mime type is known to be textual.
+func isText(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		strings.HasSuffix(mt, "+xml"), strings.HasSuffix(mt, "+json"),
+		mt == "application/json", mt == "application/xml",
+		mt == "application/javascript", mt == "application/x-www-form-urlencoded":
+		return true
+	}
+	return false
+}
+
+func harHeaders(h http.Header) []HARNameValue {
+	headers := []HARNameValue{}
+	for k, values := range h {
+		for _, v := range values {
+			headers = append(headers, HARNameValue{Name: k, Value: v})
+		}
+	}
+	return headers
+}
+
+func harCookies(cookies []*http.Cookie) []HARCookie {
+	result := []HARCookie{}
+	for _, c := range cookies {
+		hc := HARCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			exp := c.Expires
+			hc.Expires = &exp
+		}
+		result = append(result, hc)
+	}
+	return result
+}
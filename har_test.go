@@ -0,0 +1,105 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func TestRecordHAR(t *testing.T) {
+	s := newTestSite()
+	defer s.Close()
+
+	rec := NewHARRecorder()
+	b := New().RecordHAR(rec)
+	if _, err := b.GET(s.URL + "/redirect/"); err != nil {
+		t.Fatal(err)
+	}
+	page, err := b.POST(s.URL+"/login/", url.Values{"user": {"ronoaldo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := page.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GET(s.URL + "/private/"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buff bytes.Buffer
+	if _, err := rec.WriteTo(&buff); err != nil {
+		t.Fatal(err)
+	}
+	var har HAR
+	if err := json.Unmarshal(buff.Bytes(), &har); err != nil {
+		t.Fatalf("Invalid HAR document: %v\n%s", err, buff.String())
+	}
+	if har.Log.Version != "1.2" {
+		t.Errorf("Unexpected HAR version: %q", har.Log.Version)
+	}
+	if len(har.Log.Entries) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(har.Log.Entries))
+	}
+	if e := har.Log.Entries[0]; e.Response.Status != 302 || e.Response.RedirectURL != "/login/" {
+		t.Errorf("Unexpected redirect entry: %#v", e.Response)
+	}
+	e := har.Log.Entries[2]
+	if e.Request.PostData == nil || e.Request.PostData.Text != "user=ronoaldo" {
+		t.Errorf("Unexpected post data: %#v", e.Request.PostData)
+	}
+	if e.Response.Content.Text != "OK" || len(e.Response.Cookies) != 1 {
+		t.Errorf("Unexpected response: %#v", e.Response)
+	}
+	if e = har.Log.Entries[3]; len(e.Request.Cookies) != 1 {
+		t.Errorf("Expected session cookie to be recorded in the request, got %#v", e.Request.Cookies)
+	}
+}
+
+func TestRecordHARFailedRequest(t *testing.T) {
+	s := newTestSite()
+	s.Close()
+
+	rec := NewHARRecorder()
+	b := New().RecordHAR(rec)
+	if _, err := b.GET(s.URL + "/"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	var buff bytes.Buffer
+	if _, err := rec.WriteTo(&buff); err != nil {
+		t.Fatal(err)
+	}
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Comment  string
+				Response struct {
+					Cookies []interface{}
+					Headers []interface{}
+				}
+				Timings map[string]float64
+			}
+		}
+	}
+	if err := json.Unmarshal(buff.Bytes(), &har); err != nil {
+		t.Fatal(err)
+	}
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(har.Log.Entries))
+	}
+	e := har.Log.Entries[0]
+	if e.Comment == "" {
+		t.Errorf("Expected the error in the entry comment")
+	}
+	if e.Response.Cookies == nil || e.Response.Headers == nil {
+		t.Errorf("Expected response cookies and headers to be arrays:\n%s", buff.String())
+	}
+	for _, phase := range []string{"send", "wait", "receive"} {
+		if v, ok := e.Timings[phase]; !ok || v < 0 {
+			t.Errorf("Expected a non-negative %s timing, got %v", phase, e.Timings)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Profile is a coherent set of headers that mimics a real browser.
+// Accept-Encoding is never part of a profile, so the transport can
+// transparently decompress responses.
+//
+// Note that net/http writes request headers in its own order,
+// so header ordering can not be configured.
+type Profile struct {
+	// UserAgent is sent unless one is set with Bot.SetUA.
+	UserAgent string
+
+	// Header contains the headers sent in every request.
+	Header http.Header
+
+	// FetchMetadata enables the Sec-Fetch-* request headers.
+	FetchMetadata bool
+}
+
+var (
+	// Firefox is the profile of a recent Firefox desktop browser.
+	Firefox = Profile{
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+		Header: http.Header{
+			"Accept":                    {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/png,image/svg+xml,*/*;q=0.8"},
+			"Accept-Language":           {"en-US,en;q=0.5"},
+			"Upgrade-Insecure-Requests": {"1"},
+		},
+		FetchMetadata: true,
+	}
+
+	// Chrome is the profile of a recent Chrome desktop browser.
+	Chrome = Profile{
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36",
+		Header: http.Header{
+			"Accept":                    {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			"Accept-Language":           {"en-US,en;q=0.9"},
+			"Sec-Ch-Ua":                 {`"Chromium";v="130", "Google Chrome";v="130", "Not?A_Brand";v="99"`},
+			"Sec-Ch-Ua-Mobile":          {"?0"},
+			"Sec-Ch-Ua-Platform":        {`"Windows"`},
+			"Upgrade-Insecure-Requests": {"1"},
+		},
+		FetchMetadata: true,
+	}
+)
+
+// UseProfile makes the Bot send the headers from the browser profile.
+// Headers set with SetHeader and SetHostHeader take precedence.
+func (bot *Bot) UseProfile(p Profile) *Bot {
+	p.Header = p.Header.Clone()
+	bot.profile = &p
+	return bot
+}
+
+// SetHeader sets a default header sent in all requests.
+// Headers already present in the request are not changed.
+func (bot *Bot) SetHeader(name, value string) *Bot {
+	if bot.headers == nil {
+		bot.headers = make(http.Header)
+	}
+	bot.headers.Set(name, value)
+	return bot
+}
+
+// SetHostHeader sets a default header sent in requests to host,
+// overriding the value set with SetHeader.
+// The host must match the request URL host, including the port if any.
+func (bot *Bot) SetHostHeader(host, name, value string) *Bot {
+	if bot.hosts == nil {
+		bot.hosts = make(map[string]http.Header)
+	}
+	if bot.hosts[host] == nil {
+		bot.hosts[host] = make(http.Header)
+	}
+	bot.hosts[host].Set(name, value)
+	return bot
+}
+
+func (bot *Bot) userAgent() string {
+	switch {
+	case bot.ua != "":
+		return bot.ua
+	case bot.profile != nil && bot.profile.UserAgent != "":
+		return bot.profile.UserAgent
+	}
+	return DefaultUserAgent
+}
+
+// setHeaders sets the User-Agent and the default headers in each request.
+func (bot *Bot) setHeaders(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		req := &request{Request: r}
+		req.setUserAgent(bot.userAgent())
+		defaults := make(http.Header)
+		if p := bot.profile; p != nil {
+			copyHeaders(defaults, p.Header)
+			if p.FetchMetadata {
+				copyHeaders(defaults, fetchMetadata(r))
+			}
+		}
+		copyHeaders(defaults, bot.headers)
+		copyHeaders(defaults, bot.hosts[r.URL.Host])
+		h := req.header()
+		for k, v := range defaults {
+			if _, ok := h[k]; !ok || k == "User-Agent" {
+				h[k] = append([]string(nil), v...)
+			}
+		}
+		return next.RoundTrip(req.Request)
+	})
+}
+
+// copyHeaders copies all values from src to dst, replacing existing ones.
+func copyHeaders(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+// fetchMetadata returns the Sec-Fetch-* headers a browser sends
+// when the user navigates to the request URL.
+func fetchMetadata(r *http.Request) http.Header {
+	site := "none"
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host != "" {
+		switch {
+		case ref.Scheme == r.URL.Scheme && ref.Host == r.URL.Host:
+			site = "same-origin"
+		case sameSite(ref.Hostname(), r.URL.Hostname()):
+			site = "same-site"
+		default:
+			site = "cross-site"
+		}
+	}
+	return http.Header{
+		"Sec-Fetch-Dest": {"document"},
+		"Sec-Fetch-Mode": {"navigate"},
+		"Sec-Fetch-Site": {site},
+		"Sec-Fetch-User": {"?1"},
+	}
+}
+
+// sameSite approximates the registrable domain comparison by
+// checking the last two labels of both host names.
+func sameSite(a, b string) bool {
+	lastTwo := func(host string) string {
+		labels := strings.Split(host, ".")
+		if len(labels) > 2 {
+			labels = labels[len(labels)-2:]
+		}
+		return strings.Join(labels, ".")
+	}
+	return lastTwo(a) == lastTwo(b)
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestDefaultHeaders(t *testing.T) {
+	site := bottest.NewSite().Page("/", "OK").Page("/next", "OK")
+	defer site.Close()
+	u, _ := url.Parse(site.URL)
+
+	b := ReuseClient(&http.Client{}).
+		UseProfile(Firefox).
+		SetHeader("Accept-Language", "pt-BR").
+		SetHostHeader(u.Host, "X-Api-Key", "abc").
+		TrackReferer(true)
+	if _, err := b.GET(site.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	site.AssertHeader(t, "/", "User-Agent", Firefox.UserAgent)
+	site.AssertHeader(t, "/", "Accept", Firefox.Header.Get("Accept"))
+	site.AssertHeader(t, "/", "Accept-Language", "pt-BR")
+	site.AssertHeader(t, "/", "X-Api-Key", "abc")
+	site.AssertHeader(t, "/", "Sec-Fetch-Site", "none")
+	site.AssertHeader(t, "/", "Referer", "")
+
+	if _, err := b.GET(site.URL + "/next"); err != nil {
+		t.Fatal(err)
+	}
+	site.AssertHeader(t, "/next", "Referer", site.URL+"/")
+	site.AssertHeader(t, "/next", "Sec-Fetch-Site", "same-origin")
+
+	// Explicit headers in the request are preserved
+	req, _ := http.NewRequest("GET", site.URL+"/next", nil)
+	req.Header.Set("Accept", "application/json")
+	if _, err := b.SetUA("Custom/1.0").Do(req); err != nil {
+		t.Fatal(err)
+	}
+	site.AssertHeader(t, "/next", "Accept", "application/json")
+	site.AssertHeader(t, "/next", "User-Agent", "Custom/1.0")
+}
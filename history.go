@@ -1,18 +1,29 @@
 package bot
 
+import "sync"
+
 // History retains in-memory records of navigation entries.
+// It is safe for concurrent use.
 type History struct {
+	mu      sync.Mutex
 	history []string
+
+	// page is the most recent page returned, used as the navigation
+	// source for the next request.
+	page *Page
 }
 
 // Entries return the recent URLs visited.
 func (h *History) Entries() []string {
-	return h.history
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.history...)
 }
 
 // Current returs the most recent visited URL.
-// This method is not concurrent safe.
 func (h *History) Current() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	if len(h.history) == 0 {
 		return ""
 	}
@@ -20,7 +31,22 @@ func (h *History) Current() string {
 }
 
 // Add appends a new entry to the history.
-// This method is not concurrent safe.
 func (h *History) Add(entry string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.history = append(h.history, entry)
 }
+
+// last returns the most recent page returned.
+func (h *History) last() *Page {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.page
+}
+
+// setLast records page as the most recent page returned.
+func (h *History) setLast(page *Page) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.page = page
+}
@@ -4,16 +4,25 @@
 package bot
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 )
 
-func logf(level string, msg string, args ...interface{}) {
-	log.Printf(level+":"+msg, args...)
-}
+// discardHandler is a slog.Handler that drops every record.
+// It is used as the default handler so the package never writes
+// to the global logger unless asked to.
+type discardHandler struct{}
 
-func debugf(msg string, args ...interface{}) {
-	if os.Getenv("DEBUG") == "true" {
-		logf("DEBUG", msg, args...)
-	}
-}
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var (
+	discardLogger = slog.New(discardHandler{})
+
+	// debugLogger is used when debugging is enabled with Bot.Debug
+	// but no logger was configured with Bot.SetLogger.
+	debugLogger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+)
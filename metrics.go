@@ -0,0 +1,292 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the metrics reported by the Bot.
+const (
+	// MetricRequests counts the requests sent, labeled by host, method
+	// and status. The status is "error" for network errors.
+	MetricRequests = "bot_requests_total"
+
+	// MetricRequestDuration observes the seconds until the response
+	// headers are received, labeled by host and method.
+	MetricRequestDuration = "bot_request_duration_seconds"
+
+	// MetricBytesOut and MetricBytesIn count the bytes of the request
+	// and response bodies, labeled by host.
+	MetricBytesOut = "bot_request_bytes_total"
+	MetricBytesIn  = "bot_response_bytes_total"
+
+	// MetricRetries counts the requests sent again, labeled by host and
+	// reason: "auth", "proxy" or "session".
+	MetricRetries = "bot_retries_total"
+
+	// MetricRedirects counts the redirects followed, including refresh
+	// redirects, labeled by host.
+	MetricRedirects = "bot_redirects_total"
+
+	// MetricParseDuration observes the seconds spent parsing pages,
+	// labeled by kind: "forms" or "tables".
+	MetricParseDuration = "bot_parse_duration_seconds"
+)
+
+// Labels are the dimensions of a metric, such as the host.
+type Labels map[string]string
+
+// Metrics receives the measurements of a Bot. Implementations must be
+// safe for concurrent use. PrometheusMetrics is provided, the botexpvar
+// package publishes them with expvar, and other systems can be
+// integrated by implementing it.
+type Metrics interface {
+	// Add increments the counter name by delta.
+	Add(name string, labels Labels, delta float64)
+
+	// Observe records the value in the histogram name.
+	Observe(name string, labels Labels, value float64)
+}
+
+// nopMetrics discards all measurements.
+type nopMetrics struct{}
+
+func (nopMetrics) Add(string, Labels, float64)     {}
+func (nopMetrics) Observe(string, Labels, float64) {}
+
+// SetMetrics configures where the Bot reports its measurements.
+// By default, nothing is reported. Passing nil restores the default.
+func (bot *Bot) SetMetrics(m Metrics) *Bot {
+	bot.metrics = m
+	return bot
+}
+
+// meter returns the Metrics to be used by the Bot.
+func (bot *Bot) meter() Metrics {
+	if bot == nil || bot.metrics == nil {
+		return nopMetrics{}
+	}
+	return bot.metrics
+}
+
+// retried counts a request sent again.
+func (bot *Bot) retried(r *http.Request, reason string) {
+	if stats, ok := r.Context().Value(statsKey).(*callStats); ok {
+		stats.retries.Add(1)
+	}
+	bot.meter().Add(MetricRetries, Labels{"host": r.URL.Host, "reason": reason}, 1)
+}
+
+// measureRequests reports the requests sent, their duration and size.
+func (bot *Bot) measureRequests(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		m := bot.meter()
+		if _, ok := m.(nopMetrics); ok {
+			return next.RoundTrip(r)
+		}
+		host := r.URL.Host
+		if r.ContentLength > 0 {
+			m.Add(MetricBytesOut, Labels{"host": host}, float64(r.ContentLength))
+		}
+		start := time.Now()
+		resp, err := next.RoundTrip(r)
+		m.Observe(MetricRequestDuration, Labels{"host": host, "method": r.Method}, time.Since(start).Seconds())
+		status := "error"
+		if err == nil {
+			status = strconv.Itoa(resp.StatusCode)
+			resp.Body = &countingBody{ReadCloser: resp.Body, m: m, host: host}
+		}
+		m.Add(MetricRequests, Labels{"host": host, "method": r.Method, "status": status}, 1)
+		return resp, err
+	})
+}
+
+// countingBody reports the bytes read from a response body.
+type countingBody struct {
+	io.ReadCloser
+	m    Metrics
+	host string
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.m.Add(MetricBytesIn, Labels{"host": b.host}, float64(n))
+	}
+	return n, err
+}
+
+// observeParse reports the time spent parsing the page since start.
+func (page *Page) observeParse(kind string, start time.Time) {
+	if page == nil {
+		return
+	}
+	page.bot.meter().Observe(MetricParseDuration, Labels{"kind": kind}, time.Since(start).Seconds())
+}
+
+// labelKey returns the labels sorted by name, in the Prometheus
+// text format, such as {host="example.com",method="GET"}.
+func labelKey(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// DefaultBuckets are the histogram upper bounds, in seconds,
+// used by PrometheusMetrics when none are given.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// histogram is a cumulative histogram.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// PrometheusMetrics keeps the measurements in memory, and serves them
+// in the Prometheus text exposition format. Register it in a server:
+//
+//	m := bot.NewPrometheusMetrics()
+//	b := bot.New().SetMetrics(m)
+//	http.Handle("/metrics", m)
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+// NewPrometheusMetrics returns an empty PrometheusMetrics, with the
+// histogram buckets, or DefaultBuckets.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &PrometheusMetrics{
+		buckets:    b,
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+// Add implements Metrics.
+func (p *PrometheusMetrics) Add(name string, labels Labels, delta float64) {
+	key := labelKey(labels)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	series := p.counters[name]
+	if series == nil {
+		series = make(map[string]float64)
+		p.counters[name] = series
+	}
+	series[key] += delta
+}
+
+// Observe implements Metrics.
+func (p *PrometheusMetrics) Observe(name string, labels Labels, value float64) {
+	key := labelKey(labels)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	series := p.histograms[name]
+	if series == nil {
+		series = make(map[string]*histogram)
+		p.histograms[name] = series
+	}
+	h := series[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(p.buckets))}
+		series[key] = h
+	}
+	for i, le := range p.buckets {
+		if value <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	p.mu.Lock()
+	for _, name := range sortedKeys(p.counters) {
+		fmt.Fprintf(&b, "# TYPE %s counter\n", name)
+		series := p.counters[name]
+		for _, key := range sortedKeys(series) {
+			fmt.Fprintf(&b, "%s%s %s\n", name, key, formatFloat(series[key]))
+		}
+	}
+	for _, name := range sortedKeys(p.histograms) {
+		fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+		series := p.histograms[name]
+		for _, key := range sortedKeys(series) {
+			h := series[key]
+			for i, le := range p.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(key, "le", formatFloat(le)), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(key, "le", "+Inf"), h.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, key, formatFloat(h.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, key, h.count)
+		}
+	}
+	p.mu.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+// withLabel adds the label to the label set key.
+func withLabel(key, name, value string) string {
+	label := name + "=" + strconv.Quote(value)
+	if key == "" {
+		return "{" + label + "}"
+	}
+	return key[:len(key)-1] + "," + label + "}"
+}
+
+// formatFloat formats v as in the Prometheus text format.
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	s := bottest.NewSite().
+		Redirect("/old/", "/table/", http.StatusFound).
+		Table("/table/", []string{"A"}, []string{"1"}).
+		Error("/missing/", http.StatusNotFound, "Not Found").
+		Page("/post/", "OK")
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	m := NewPrometheusMetrics(0.5, 1)
+	b := New().BaseURL(s.URL).SetMetrics(m)
+	page, err := b.GET("/old/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := page.Tables(); err != nil {
+		t.Fatal(err)
+	}
+	b.GET("/missing/")
+	page, err = b.POST("/post/", url.Values{"a": {"b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "OK")
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	out := w.Body.String()
+	for _, want := range []string{
+		"# TYPE bot_requests_total counter\n",
+		`bot_requests_total{host="` + host + `",method="GET",status="302"} 1`,
+		`bot_requests_total{host="` + host + `",method="GET",status="200"} 1`,
+		`bot_requests_total{host="` + host + `",method="GET",status="404"} 1`,
+		`bot_requests_total{host="` + host + `",method="POST",status="200"} 1`,
+		`bot_redirects_total{host="` + host + `"} 1`,
+		`bot_request_bytes_total{host="` + host + `"} 3`,
+		`bot_response_bytes_total{host="` + host + `"} `,
+		"# TYPE bot_request_duration_seconds histogram\n",
+		`bot_request_duration_seconds_bucket{host="` + host + `",method="GET",le="+Inf"} 3`,
+		`bot_request_duration_seconds_count{host="` + host + `",method="POST"} 1`,
+		`bot_parse_duration_seconds_bucket{kind="tables",le="1"} 1`,
+		`bot_parse_duration_seconds_count{kind="tables"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, out)
+		}
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type: %q", ct)
+	}
+}
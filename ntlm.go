@@ -0,0 +1,212 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLM message flags, as defined in [MS-NLMP] section 2.2.2.5.
+const (
+	ntlmNegotiateUnicode         = 0x00000001
+	ntlmRequestTarget            = 0x00000004
+	ntlmNegotiateNTLM            = 0x00000200
+	ntlmNegotiateAlwaysSign      = 0x00008000
+	ntlmNegotiateExtendedSession = 0x00080000
+	ntlmNegotiateTargetInfo      = 0x00800000
+	ntlmNegotiate128             = 0x20000000
+	ntlmNegotiate56              = 0x80000000
+
+	ntlmFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSession |
+		ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+)
+
+var (
+	ntlmSignature = []byte("NTLMSSP\x00")
+
+	errInvalidNTLMChallenge = errors.New("bot: invalid NTLM challenge message")
+)
+
+// ntlmNegotiate returns the NTLM NEGOTIATE_MESSAGE.
+func ntlmNegotiate() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmFlags)
+	return msg
+}
+
+// ntlmAuthenticate returns the NTLMv2 AUTHENTICATE_MESSAGE answering the
+// CHALLENGE_MESSAGE challenge. The user can be prefixed by the domain,
+// as in DOMAIN\user.
+func ntlmAuthenticate(challenge []byte, user, pass string) ([]byte, error) {
+	if len(challenge) < 48 || !bytes.Equal(challenge[:8], ntlmSignature) || binary.LittleEndian.Uint32(challenge[8:]) != 2 {
+		return nil, errInvalidNTLMChallenge
+	}
+	serverChallenge := challenge[24:32]
+	targetInfo, ok := ntlmSecurityBuffer(challenge, 40)
+	if !ok {
+		return nil, errInvalidNTLMChallenge
+	}
+	domain := ""
+	if i := strings.IndexAny(user, `\/`); i >= 0 {
+		domain, user = user[:i], user[i+1:]
+	}
+
+	clientChallenge := make([]byte, 8)
+	rand.Read(clientChallenge)
+	timestamp := ntlmTimestamp(targetInfo)
+	key := ntowfv2(user, pass, domain)
+	nt := ntlmv2Response(key, serverChallenge, clientChallenge, timestamp, targetInfo)
+	lm := append(hmacMD5(key, serverChallenge, clientChallenge), clientChallenge...)
+
+	workstation, _ := os.Hostname()
+	payload := [][]byte{lm, nt, utf16le(domain), utf16le(user), utf16le(strings.ToUpper(workstation)), nil}
+	msg := make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := len(msg)
+	for i, p := range payload {
+		field := msg[12+i*8:]
+		binary.LittleEndian.PutUint16(field[0:], uint16(len(p)))
+		binary.LittleEndian.PutUint16(field[2:], uint16(len(p)))
+		binary.LittleEndian.PutUint32(field[4:], uint32(offset))
+		offset += len(p)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], ntlmFlags)
+	for _, p := range payload {
+		msg = append(msg, p...)
+	}
+	return msg, nil
+}
+
+// ntlmSecurityBuffer returns the payload referenced by the security
+// buffer at offset in msg.
+func ntlmSecurityBuffer(msg []byte, offset int) ([]byte, bool) {
+	if len(msg) < offset+8 {
+		return nil, false
+	}
+	size := int(binary.LittleEndian.Uint16(msg[offset:]))
+	start := int(binary.LittleEndian.Uint32(msg[offset+4:]))
+	if start+size > len(msg) {
+		return nil, false
+	}
+	return msg[start : start+size], true
+}
+
+// ntlmTimestamp returns the MsvAvTimestamp from the target info,
+// or the current time in Windows FILETIME format.
+func ntlmTimestamp(targetInfo []byte) []byte {
+	for b := targetInfo; len(b) >= 4; {
+		id, size := binary.LittleEndian.Uint16(b), int(binary.LittleEndian.Uint16(b[2:]))
+		if id == 0 || len(b) < 4+size {
+			break
+		}
+		if id == 7 && size == 8 {
+			return b[4:12]
+		}
+		b = b[4+size:]
+	}
+	ts := make([]byte, 8)
+	// FILETIME counts 100ns intervals since January 1, 1601.
+	binary.LittleEndian.PutUint64(ts, uint64(time.Now().UnixNano()/100+116444736000000000))
+	return ts
+}
+
+// ntowfv2 computes the NTLMv2 response key.
+func ntowfv2(user, pass, domain string) []byte {
+	hash := md4Sum(utf16le(pass))
+	return hmacMD5(hash[:], utf16le(strings.ToUpper(user)+domain))
+}
+
+// ntlmv2Response computes the NTLMv2 NtChallengeResponse.
+func ntlmv2Response(key, serverChallenge, clientChallenge, timestamp, targetInfo []byte) []byte {
+	var temp []byte
+	temp = append(temp, 1, 1, 0, 0, 0, 0, 0, 0)
+	temp = append(temp, timestamp...)
+	temp = append(temp, clientChallenge...)
+	temp = append(temp, 0, 0, 0, 0)
+	temp = append(temp, targetInfo...)
+	temp = append(temp, 0, 0, 0, 0)
+	proof := hmacMD5(key, serverChallenge, temp)
+	return append(proof, temp...)
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// utf16le encodes s as UTF-16 little endian.
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// md4Sum computes the MD4 checksum, as defined in RFC 1320.
+// MD4 is broken, and is used only because NTLM requires it.
+func md4Sum(data []byte) [16]byte {
+	msg := append([]byte(nil), data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(data))*8)
+	msg = append(msg, length[:]...)
+
+	s := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+	for len(msg) > 0 {
+		var x [16]uint32
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[4*i:])
+		}
+		a, b, c, d := s[0], s[1], s[2], s[3]
+
+		for _, i := range []uint{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+((b&c)|(^b&d))+x[i], 3)
+			d = bits.RotateLeft32(d+((a&b)|(^a&c))+x[i+1], 7)
+			c = bits.RotateLeft32(c+((d&a)|(^d&b))+x[i+2], 11)
+			b = bits.RotateLeft32(b+((c&d)|(^c&a))+x[i+3], 19)
+		}
+		for _, i := range []uint{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+((b&c)|(b&d)|(c&d))+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+((a&b)|(a&c)|(b&c))+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+((d&a)|(d&b)|(a&b))+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+((c&d)|(c&a)|(d&a))+x[i+12]+0x5a827999, 13)
+		}
+		for _, i := range []uint{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+(b^c^d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+(a^b^c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+(d^a^b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+(c^d^a)+x[i+12]+0x6ed9eba1, 15)
+		}
+
+		s[0], s[1], s[2], s[3] = s[0]+a, s[1]+b, s[2]+c, s[3]+d
+		msg = msg[64:]
+	}
+	var sum [16]byte
+	for i, v := range s {
+		binary.LittleEndian.PutUint32(sum[4*i:], v)
+	}
+	return sum
+}
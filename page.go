@@ -5,13 +5,17 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -74,6 +78,15 @@ type Table struct {
 type Page struct {
 	resp *http.Response
 	body []byte
+
+	// mu guards body, that is read on demand, and the policy of the
+	// <meta name="referrer"> tag, parsed once from the body.
+	mu           sync.Mutex
+	policy       string
+	policyParsed bool
+
+	// bot is the Bot that fetched this page, if any.
+	bot *Bot
 }
 
 // Raw returns the raw Response, after reading all the data from the response Body.
@@ -110,6 +123,15 @@ func (page *Page) Bytes() ([]byte, error) {
 	return page.body, nil
 }
 
+// document parses the page body.
+func (page *Page) document() (*goquery.Document, error) {
+	body, err := page.Body()
+	if err != nil {
+		return nil, err
+	}
+	return goquery.NewDocumentFromReader(body)
+}
+
 // Tables parses the response body, and extract all <table>s from it.
 // The result is nil, if there is an error reading the response,
 // or if there is an error building the document reader.
@@ -121,6 +143,7 @@ func (page *Page) Bytes() ([]byte, error) {
 // in the Table.RawCells. This is usefull if you need to parse links inside
 // tables.
 func (page *Page) Tables() ([]Table, error) {
+	defer page.observeParse("tables", time.Now())
 	var (
 		body io.Reader
 		doc  *goquery.Document
@@ -132,7 +155,7 @@ func (page *Page) Tables() ([]Table, error) {
 	if doc, err = goquery.NewDocumentFromReader(body); err != nil {
 		return nil, err
 	}
-	debugf("Loaded document from response.")
+	page.log().Debug("loaded document from response")
 	var tables []Table
 	doc.Find("table").Each(func(i int, t *goquery.Selection) {
 		table := Table{
@@ -148,7 +171,7 @@ func (page *Page) Tables() ([]Table, error) {
 				if raw, err := th.Html(); err == nil {
 					rawRow = append(rawRow, raw)
 				} else {
-					debugf("Error parsing node HTML: %v", err)
+					page.log().Warn("parse warning: invalid table cell HTML", "err", err)
 				}
 			})
 			row := make([]string, 0, 10)
@@ -157,7 +180,7 @@ func (page *Page) Tables() ([]Table, error) {
 				if raw, err := td.Html(); err == nil {
 					rawRow = append(rawRow, raw)
 				} else {
-					debugf("Error parsing node HTML: %v", err)
+					page.log().Warn("parse warning: invalid table cell HTML", "err", err)
 				}
 			})
 			if len(row) > 0 {
@@ -188,6 +211,7 @@ func (page *Page) Tables() ([]Table, error) {
 // For selects, the returned value is the option marked with the "selected"
 // attribute, or empty otherwise.
 func (page *Page) Forms() ([]Form, error) {
+	defer page.observeParse("forms", time.Now())
 	var (
 		body io.Reader
 		doc  *goquery.Document
@@ -199,7 +223,7 @@ func (page *Page) Forms() ([]Form, error) {
 	if doc, err = goquery.NewDocumentFromReader(body); err != nil {
 		return nil, err
 	}
-	debugf("Loaded document from response: %#v", doc)
+	page.log().Debug("loaded document from response")
 
 	var forms []Form
 	// Parse the forms in the document
@@ -208,7 +232,7 @@ func (page *Page) Forms() ([]Form, error) {
 		action := f.AttrOr("action", "")
 		method := f.AttrOr("method", "GET")
 		name := f.AttrOr("name", "")
-		debugf("Found new form[id=%s, action=%s, method=%s]", formid, action, method)
+		page.log().Debug("found form", "id", formid, "action", action, "method", method)
 		fields := make(url.Values)
 
 		// Parse all input fields
@@ -216,9 +240,12 @@ func (page *Page) Forms() ([]Form, error) {
 			_type := input.AttrOr("type", "")
 			name := input.AttrOr("name", "")
 			value := input.AttrOr("value", "")
-			debugf("> Parsing input[type=%s, name=%s, value=%s]", _type, name, value)
+			page.log().Debug("parsing input", "type", _type, "name", name)
 			switch strings.ToLower(_type) {
-			case "text", "hidden", "password", "":
+			case "password":
+				page.bot.redactField(name)
+				fields[name] = append(fields[name], value)
+			case "text", "hidden", "":
 				fields[name] = append(fields[name], value)
 			case "radio":
 				// We should only store the selected radio value
@@ -236,7 +263,7 @@ func (page *Page) Forms() ([]Form, error) {
 		// Parse all select fields
 		f.Find("select").Each(func(j int, _select *goquery.Selection) {
 			name := _select.AttrOr("name", "")
-			debugf("Processando select[name=%s]", name)
+			page.log().Debug("parsing select", "name", name)
 			if name != "" {
 				_select.Find("option").Each(func(k int, option *goquery.Selection) {
 					v := ""
@@ -265,6 +292,43 @@ func (page *Page) Forms() ([]Form, error) {
 	return forms, nil
 }
 
+// formRequest returns the request that submits the form with the
+// values, as a browser does. The form action is resolved against the
+// page URL, and GET forms replace the action query with the values.
+// The request uses the context ctx.
+func (page *Page) formRequest(ctx context.Context, form *Form, values url.Values) (*http.Request, error) {
+	base := page.URL()
+	if base == nil {
+		return nil, errNilResp
+	}
+	action, err := base.Parse(form.Action)
+	if err != nil {
+		return nil, err
+	}
+	var req *http.Request
+	if strings.EqualFold(form.Method, "POST") {
+		req, err = http.NewRequestWithContext(ctx, "POST", action.String(), strings.NewReader(values.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		action.RawQuery = values.Encode()
+		if req, err = http.NewRequestWithContext(ctx, "GET", action.String(), nil); err != nil {
+			return nil, err
+		}
+	}
+	return withSource(req, &source{url: base, policy: page.ReferrerPolicy()}), nil
+}
+
+// log returns the logger of the Bot that fetched the page.
+func (page *Page) log() *slog.Logger {
+	if page == nil {
+		return discardLogger
+	}
+	return page.bot.log()
+}
+
 // sanityCheck makes sure that the page is valid, and is wrapping a valid response.
 func (page *Page) sanityCheck() error {
 	if page == nil {
@@ -281,6 +345,8 @@ func (page *Page) sanityCheck() error {
 
 // ensureBodyReady makes sure that the body is read once from the response.
 func (page *Page) ensureBodyReady() error {
+	page.mu.Lock()
+	defer page.mu.Unlock()
 	if page.body == nil {
 		var err error
 		page.body, err = ioutil.ReadAll(page.resp.Body)
@@ -300,3 +366,17 @@ func (page *Page) ensureBodyReady() error {
 	}
 	return nil
 }
+
+// discard reads and closes the response body, if it was not read yet,
+// so the connection can be reused when the page is not needed.
+func (page *Page) discard() {
+	if page.sanityCheck() != nil {
+		return
+	}
+	page.mu.Lock()
+	defer page.mu.Unlock()
+	if page.body == nil {
+		drain(page.resp)
+		page.body = []byte{}
+	}
+}
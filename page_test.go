@@ -4,18 +4,14 @@
 package bot
 
 import (
-	"bytes"
-	"io"
-	"io/ioutil"
 	"net/http"
-	"strings"
 	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
 )
 
 func TestPageRaw(t *testing.T) {
-	p := &Page{
-		resp: newResponse(ioutil.NopCloser(new(bytes.Buffer))),
-	}
+	p := samplePage(t, "")
 	resp, err := p.Raw()
 	if err != nil {
 		t.Error(err)
@@ -26,9 +22,7 @@ func TestPageRaw(t *testing.T) {
 }
 
 func TestPageForm(t *testing.T) {
-	p := &Page{
-		resp: newResponse(sampleHTMLPage()),
-	}
+	p := samplePage(t, sampleHTML)
 
 	forms, err := p.Forms()
 	if err != nil {
@@ -43,9 +37,7 @@ func TestPageForm(t *testing.T) {
 }
 
 func TestMultipleCalls(t *testing.T) {
-	p := &Page{
-		resp: newResponse(sampleHTMLPage()),
-	}
+	p := samplePage(t, sampleHTML)
 
 	f1, err := p.Forms()
 	if err != nil {
@@ -62,9 +54,7 @@ func TestMultipleCalls(t *testing.T) {
 }
 
 func TestPageTable(t *testing.T) {
-	p := &Page{
-		resp: newResponse(sampleHTMLPage()),
-	}
+	p := samplePage(t, sampleHTML)
 	tables, err := p.Tables()
 	if err != nil {
 		t.Error(err)
@@ -91,8 +81,18 @@ func TestPageTable(t *testing.T) {
 	}
 }
 
-func sampleHTMLPage() io.ReadCloser {
-	return ioutil.NopCloser(strings.NewReader(`
+func TestPageLatin1(t *testing.T) {
+	site := bottest.NewSite().Charset("/", "iso-8859-1", "<p>Informação</p>")
+	defer site.Close()
+	page, err := ReuseClient(&http.Client{}).GET(site.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "<p>Informação</p>")
+}
+
+// sampleHTML has forms and tables to be parsed by Page methods.
+const sampleHTML = `
 <html>
 	<head></head>
 	<body>
@@ -139,11 +139,15 @@ func sampleHTMLPage() io.ReadCloser {
 			</tr>
 		</table>
 	</body>
-</html>`))
-}
+</html>`
 
-func newResponse(body io.ReadCloser) *http.Response {
-	return &http.Response{
-		Body: body,
+// samplePage returns a Page fetched from a fake site serving doc.
+func samplePage(t *testing.T, doc string) *Page {
+	site := bottest.NewSite().Page("/", doc)
+	t.Cleanup(site.Close)
+	page, err := ReuseClient(&http.Client{}).GET(site.URL + "/")
+	if err != nil {
+		t.Fatal(err)
 	}
+	return page
 }
@@ -0,0 +1,274 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// NextFunc returns the request for the page after page,
+// or nil if page is the last one.
+type NextFunc func(page *Page) (*http.Request, error)
+
+// NextLink follows the first link matching the CSS selector, such as
+// "a.next" or "a:contains('Next')". If the selector matches another
+// element, the first link inside it is used. Links to __doPostBack
+// post back the ASP.NET main form. The page is the last one if there
+// is no such link.
+func NextLink(selector string) NextFunc {
+	return func(page *Page) (*http.Request, error) {
+		doc, err := page.document()
+		if err != nil {
+			return nil, err
+		}
+		link := doc.Find(selector).First()
+		if !link.Is("a[href]") {
+			link = link.Find("a[href]").First()
+		}
+		href, ok := link.Attr("href")
+		if !ok {
+			return nil, nil
+		}
+		href = strings.TrimSpace(href)
+		if target, argument, ok := ParsePostBack(href); ok {
+			return page.doPostBackRequest(page.bot.context(), target, argument, nil)
+		}
+		base := page.URL()
+		if base == nil {
+			return nil, errNilResp
+		}
+		u, err := base.Parse(href)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, nil
+		}
+		req, err := http.NewRequestWithContext(page.bot.context(), "GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		return withSource(req, &source{url: base, policy: page.ReferrerPolicy()}), nil
+	}
+}
+
+// NextForm submits the form that contains the first element matching
+// the CSS selector, with the fields replacing the form values. If the
+// element is a named submit button, its value is also submitted.
+// The page is the last one if there is no such element, or if it is
+// disabled.
+func NextForm(selector string, fields url.Values) NextFunc {
+	return func(page *Page) (*http.Request, error) {
+		forms, err := page.Forms()
+		if err != nil {
+			return nil, err
+		}
+		doc, err := page.document()
+		if err != nil {
+			return nil, err
+		}
+		el := doc.Find(selector).First()
+		if _, disabled := el.Attr("disabled"); el.Length() == 0 || disabled {
+			return nil, nil
+		}
+		form := el
+		if !form.Is("form") {
+			form = el.Closest("form")
+		}
+		i := doc.Find("form").IndexOfSelection(form)
+		if i < 0 || i >= len(forms) {
+			return nil, nil
+		}
+		values := make(url.Values)
+		for k, v := range forms[i].Fields {
+			if !strings.HasSuffix(k, ":options") {
+				values[k] = append([]string(nil), v...)
+			}
+		}
+		form.Find("input").Each(func(i int, s *goquery.Selection) {
+			if strings.EqualFold(s.AttrOr("type", ""), "submit") {
+				values.Del(s.AttrOr("name", ""))
+			}
+		})
+		if name := el.AttrOr("name", ""); name != "" && el.Is("input, button") {
+			values.Set(name, el.AttrOr("value", ""))
+		}
+		for k, v := range fields {
+			values[k] = v
+		}
+		return page.formRequest(page.bot.context(), &forms[i], values)
+	}
+}
+
+// Pager iterates over the items in a sequence of pages, such as the
+// rows of a paginated table. Only the items of the current page are
+// kept in memory, and the next page is loaded after all items of the
+// current one are consumed. Use it as a bufio.Scanner:
+//
+//	p := bot.NewPager(b, first, extract, bot.NextLink("a.next"))
+//	for p.Next() {
+//		item := p.Item()
+//	}
+//	if err := p.Err(); err != nil {
+//		...
+//	}
+//
+// The pager stops when the NextFunc returns no request, after MaxPages
+// pages, or when the next request was already made by the pager, as
+// when the last page links to itself or to the first one. GET requests
+// are also checked against the URLs visited by the pager, including
+// redirects.
+type Pager[T any] struct {
+	// MaxPages is the maximum number of pages visited, including
+	// the first one. If zero, there is no limit.
+	MaxPages int
+
+	bot     *Bot
+	extract func(*Page) ([]T, error)
+	next    NextFunc
+
+	page    *Page
+	started bool
+	pages   int
+	items   []T
+	item    T
+	err     error
+	done    bool
+
+	// seen are the hashes of the requests made by the pager,
+	// and of the URLs it visited.
+	seen map[[sha256.Size]byte]bool
+}
+
+// NewPager returns a Pager that starts at the page first, extracts items
+// from each page with extract, and loads the next page with next.
+func NewPager[T any](bot *Bot, first *Page, extract func(*Page) ([]T, error), next NextFunc) *Pager[T] {
+	p := &Pager[T]{
+		bot:     bot,
+		extract: extract,
+		next:    next,
+		page:    first,
+		seen:    make(map[[sha256.Size]byte]bool),
+	}
+	p.visited(first)
+	return p
+}
+
+// Next advances the pager to the next item, loading the next pages
+// as needed. It returns false when there are no more items, or after
+// an error.
+func (p *Pager[T]) Next() bool {
+	var zero T
+	p.item = zero
+	for len(p.items) == 0 {
+		if p.err != nil || p.done {
+			return false
+		}
+		if p.started {
+			if p.MaxPages > 0 && p.pages >= p.MaxPages {
+				p.done = true
+				return false
+			}
+			page, err := p.advance()
+			if err != nil {
+				p.err = err
+				return false
+			}
+			if page == nil {
+				p.done = true
+				return false
+			}
+			p.page = page
+		}
+		p.started = true
+		p.pages++
+		p.items, p.err = p.extract(p.page)
+	}
+	p.item = p.items[0]
+	p.items[0] = zero
+	p.items = p.items[1:]
+	return true
+}
+
+// advance loads the next page, or returns nil if there is none.
+func (p *Pager[T]) advance() (*Page, error) {
+	req, err := p.next(p.page)
+	if err != nil || req == nil {
+		return nil, err
+	}
+	key, err := requestKey(req)
+	if err != nil {
+		return nil, err
+	}
+	if p.seen[key] {
+		p.bot.log().Info("pagination loop detected", "url", req.URL.String(), "pages", p.pages)
+		return nil, nil
+	}
+	p.seen[key] = true
+	page, err := p.bot.Do(req)
+	p.visited(page)
+	return page, err
+}
+
+// visited records the GET requests that loaded the page,
+// including redirects.
+func (p *Pager[T]) visited(page *Page) {
+	if page == nil || page.resp == nil {
+		return
+	}
+	for r := page.resp.Request; r != nil; r = r.Response.Request {
+		if r.Method == "GET" {
+			p.seen[sha256.Sum256([]byte("GET "+r.URL.String()+"\n"))] = true
+		}
+		if r.Response == nil {
+			break
+		}
+	}
+}
+
+// Item returns the current item.
+func (p *Pager[T]) Item() T {
+	return p.item
+}
+
+// Page returns the page of the current item.
+func (p *Pager[T]) Page() *Page {
+	return p.page
+}
+
+// Pages returns the number of pages visited so far.
+func (p *Pager[T]) Pages() int {
+	return p.pages
+}
+
+// Err returns the first error loading or extracting items from a page.
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
+// requestKey returns the SHA-256 hash of the request method, URL and
+// body, so large bodies, such as the ASP.NET view state, are not kept.
+func requestKey(req *http.Request) ([sha256.Size]byte, error) {
+	var key [sha256.Size]byte
+	h := sha256.New()
+	io.WriteString(h, req.Method+" "+req.URL.String()+"\n")
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return key, err
+		}
+		defer body.Close()
+		if _, err := io.Copy(h, body); err != nil {
+			return key, err
+		}
+	}
+	h.Sum(key[:0])
+	return key, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+// newListingSite returns a site with 3 pages of 2 rows each, paginated
+// with links at /list/, and with a form at /search/.
+func newListingSite(next func(page int) int) *bottest.Site {
+	render := func(w http.ResponseWriter, page int, pager string) {
+		var rows [][]string
+		for i := 1; i <= 2; i++ {
+			rows = append(rows, []string{strconv.Itoa((page-1)*2 + i), strconv.Itoa(page)})
+		}
+		table := bottest.RenderTable([]string{"Row", "Page"}, rows...)
+		fmt.Fprint(w, strings.Replace(table, "</body>", pager+"</body>", 1))
+	}
+	return bottest.NewSite().
+		HandleFunc("/list/", func(w http.ResponseWriter, r *http.Request) {
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			if page == 0 {
+				page = 1
+			}
+			pager := ""
+			if n := next(page); n > 0 {
+				pager = fmt.Sprintf(`<p class="pager"><a href="?page=%d">Next &raquo;</a></p>`, n)
+			}
+			render(w, page, pager)
+		}).
+		HandleFunc("/search/", func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			page, _ := strconv.Atoi(r.PostForm.Get("page"))
+			if page == 0 {
+				page = 1
+			}
+			disabled := ""
+			if page == 3 {
+				disabled = " disabled"
+			}
+			render(w, page, fmt.Sprintf(`<form method="post" action="/search/">
+				<input type="hidden" name="q" value="bot"><input type="hidden" name="page" value="%d">
+				<input type="submit" name="next" value="Next"%s></form>`, page+1, disabled))
+		})
+}
+
+// rows extracts the table rows from a page.
+func rows(page *Page) ([][]string, error) {
+	tables, err := page.Tables()
+	if err != nil || len(tables) == 0 {
+		return nil, err
+	}
+	return tables[0].Data, nil
+}
+
+func collect(t *testing.T, p *Pager[[]string]) []string {
+	var result []string
+	for p.Next() {
+		result = append(result, p.Item()[0])
+	}
+	if err := p.Err(); err != nil {
+		t.Error(err)
+	}
+	return result
+}
+
+func TestPager(t *testing.T) {
+	s := newListingSite(func(page int) int {
+		if page < 3 {
+			return page + 1
+		}
+		return 0
+	})
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	first, err := b.GET("/list/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPager(b, first, rows, NextLink("p.pager"))
+	if got := strings.Join(collect(t, p), ","); got != "1,2,3,4,5,6" {
+		t.Errorf("Unexpected rows: %v", got)
+	}
+	if p.Pages() != 3 {
+		t.Errorf("Unexpected page count: %d", p.Pages())
+	}
+
+	first, err = b.GET("/list/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = NewPager(b, first, rows, NextLink("p.pager a"))
+	p.MaxPages = 2
+	if got := strings.Join(collect(t, p), ","); got != "1,2,3,4" {
+		t.Errorf("Unexpected rows with MaxPages: %v", got)
+	}
+
+	// Form pagination
+	first, err = b.GET("/search/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = NewPager(b, first, rows, NextForm(`input[name="next"]`, nil))
+	if got := strings.Join(collect(t, p), ","); got != "1,2,3,4,5,6" {
+		t.Errorf("Unexpected rows with form pagination: %v", got)
+	}
+	s.AssertSubmitted(t, "/search/", url.Values{"q": {"bot"}, "page": {"3"}, "next": {"Next"}})
+}
+
+func TestPagerLoop(t *testing.T) {
+	s := newListingSite(func(page int) int {
+		if page < 3 {
+			return page + 1
+		}
+		return 1
+	})
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	first, err := b.GET("/list/?page=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPager(b, first, rows, NextLink("p.pager"))
+	if got := strings.Join(collect(t, p), ","); got != "1,2,3,4,5,6" {
+		t.Errorf("Unexpected rows: %v", got)
+	}
+}
+
+func TestPagerExtractRequests(t *testing.T) {
+	s := newListingSite(func(page int) int {
+		if page < 3 {
+			return page + 1
+		}
+		return 0
+	})
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	first, err := b.GET("/list/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Requests made by extract are not pagination loops.
+	extract := func(page *Page) ([][]string, error) {
+		if _, err := b.GET("/list/?page=3"); err != nil {
+			return nil, err
+		}
+		return rows(page)
+	}
+	p := NewPager(b, first, extract, NextLink("p.pager a"))
+	if got := strings.Join(collect(t, p), ","); got != "1,2,3,4,5,6" {
+		t.Errorf("Unexpected rows: %v", got)
+	}
+}
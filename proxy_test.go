@@ -0,0 +1,111 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+// newTestProxy returns a fake HTTP proxy that answers all requests
+// with its name, and the proxied URL.
+func newTestProxy(name string) *bottest.Site {
+	return bottest.NewSite().HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.IsAbs() {
+			http.Error(w, "Not a proxy request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "%s:%s:%s", name, r.Header.Get("Proxy-Authorization"), r.URL)
+	})
+}
+
+func TestProxy(t *testing.T) {
+	site := bottest.NewSite().Page("/", "DIRECT")
+	defer site.Close()
+	p1, p2 := newTestProxy("p1"), newTestProxy("p2")
+	defer p1.Close()
+	defer p2.Close()
+	u1, _ := url.Parse(p1.URL)
+
+	b := ReuseClient(&http.Client{}).SetProxy("http://user:pass@" + u1.Host)
+	page, err := b.GET("http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "p1:Basic dXNlcjpwYXNz:http://example.com/")
+
+	b.SetHostProxy("example.com", p2.URL)
+	if page, err = b.GET("http://example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "p2::http://example.com/")
+
+	u, _ := url.Parse(site.URL)
+	b.SetHostProxy(u.Host, "direct")
+	if page, err = b.GET(site.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "DIRECT")
+}
+
+func TestProxyPool(t *testing.T) {
+	dead := newTestProxy("dead")
+	dead.Close()
+	live := newTestProxy("live")
+	defer live.Close()
+
+	pool, err := NewProxyPool(dead.URL, live.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.MaxFailures = 1
+	b := ReuseClient(&http.Client{}).UseProxyPool(pool)
+	for i := 0; i < 3; i++ {
+		page, err := b.POST("http://example.com/", url.Values{"i": {fmt.Sprint(i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkBody(t, page, "live::http://example.com/")
+	}
+	if proxies := pool.Proxies(); len(proxies) != 1 || proxies[0] != live.URL {
+		t.Errorf("Expected dead proxy to be retired, got %v", proxies)
+	}
+}
+
+func TestProxyPoolFailures(t *testing.T) {
+	slow := bottest.NewSite().HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	defer slow.Close()
+	pool, err := NewProxyPool(slow.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.MaxFailures = 1
+	b := ReuseClient(&http.Client{}).UseProxyPool(pool)
+
+	// Canceled requests do not retire the proxy
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := b.WithContext(ctx).GET("http://example.com/"); err == nil {
+		t.Errorf("Expected an error for canceled request")
+	}
+	if pool.Len() != 1 {
+		t.Errorf("Expected proxy to be kept after cancel, got %v", pool.Proxies())
+	}
+
+	// Refused tunnels retire the proxy
+	if _, err := b.GET("https://example.com/"); err == nil {
+		t.Errorf("Expected an error for refused tunnel")
+	}
+	if pool.Len() != 0 {
+		t.Errorf("Expected proxy to be retired after refused tunnel, got %v", pool.Proxies())
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultMaxRedirects is the number of redirects followed when the
+// RedirectPolicy does not set MaxHops.
+const DefaultMaxRedirects = 10
+
+// DefaultMaxRefreshDelay is the longest refresh delay followed when the
+// RedirectPolicy does not set MaxRefreshDelay.
+const DefaultMaxRefreshDelay = 3 * time.Second
+
+var (
+	// ErrRedirectHost is returned when a RedirectPolicy with SameHost
+	// forbids a redirect to another host.
+	ErrRedirectHost = errors.New("bot: redirect to another host")
+
+	// ErrRedirectDowngrade is returned when a RedirectPolicy with
+	// NoDowngrade forbids a redirect from HTTPS to HTTP.
+	ErrRedirectDowngrade = errors.New("bot: redirect from https to http")
+)
+
+// RedirectPolicy controls how redirects are followed.
+// The zero value follows up to DefaultMaxRedirects redirects.
+type RedirectPolicy struct {
+	// MaxHops is the maximum number of redirects followed.
+	// If zero, DefaultMaxRedirects is used.
+	MaxHops int
+
+	// DontFollow disables following redirects. The redirect response
+	// is returned as a Page, and its target is available with
+	// Page.Location.
+	DontFollow bool
+
+	// SameHost forbids redirects to a host other than the one
+	// in the original request.
+	SameHost bool
+
+	// NoDowngrade forbids redirects from HTTPS to HTTP.
+	NoDowngrade bool
+
+	// FollowRefresh enables following redirects made by pages with
+	// a Refresh header, a <meta http-equiv="refresh"> tag, or a simple
+	// JavaScript location assignment, as returned by Page.RefreshURL.
+	// They are followed immediately if their delay is up to
+	// MaxRefreshDelay, and are subject to the same rules as HTTP
+	// redirects.
+	FollowRefresh bool
+
+	// MaxRefreshDelay is the longest refresh delay followed with
+	// FollowRefresh. Longer delays, such as session timeout pages,
+	// are not followed. If zero, DefaultMaxRefreshDelay is used.
+	MaxRefreshDelay time.Duration
+
+	// Check, if not nil, is called before following each redirect,
+	// after the other rules are checked. It can veto the redirect by
+	// returning an error, or rewrite the target by changing req.URL.
+	// Returning http.ErrUseLastResponse stops following redirects and
+	// returns the redirect response as a Page.
+	Check func(req *http.Request, via []*http.Request) error
+}
+
+// Redirect is a response that redirected the Bot to another URL.
+type Redirect struct {
+	// URL is the URL that responded with the redirect.
+	URL *url.URL
+
+	// StatusCode is the HTTP status code of the redirect.
+	// It is a 2xx code for redirects followed with FollowRefresh.
+	StatusCode int
+}
+
+// SetRedirectPolicy configures how the Bot follows redirects.
+func (bot *Bot) SetRedirectPolicy(p RedirectPolicy) *Bot {
+	bot.redirect = p
+	return bot
+}
+
+// WithRedirectPolicy returns a shallow copy of req that follows
+// redirects according to p, instead of the Bot policy.
+func WithRedirectPolicy(req *http.Request, p RedirectPolicy) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), redirectKey, &p))
+}
+
+// redirectPolicy returns the policy for the request.
+func (bot *Bot) redirectPolicy(req *http.Request) *RedirectPolicy {
+	if p, ok := req.Context().Value(redirectKey).(*RedirectPolicy); ok {
+		return p
+	}
+	return &bot.redirect
+}
+
+// checkRedirect applies the redirect policy to req, before it is sent.
+func (bot *Bot) checkRedirect(req *http.Request, via []*http.Request) error {
+	if prev, ok := req.Context().Value(viaKey).([]*http.Request); ok && len(prev) > 0 {
+		// Include the requests before the last refresh redirect.
+		via = append(prev[:len(prev):len(prev)], via...)
+	}
+	p := bot.redirectPolicy(req)
+	from := via[len(via)-1]
+	maxHops := p.MaxHops
+	if maxHops == 0 {
+		maxHops = DefaultMaxRedirects
+	}
+	var err error
+	switch {
+	case p.DontFollow:
+		return http.ErrUseLastResponse
+	case len(via) > maxHops:
+		err = ErrTooManyRedirects
+	case p.SameHost && req.URL.Host != via[0].URL.Host:
+		err = ErrRedirectHost
+	case p.NoDowngrade && from.URL.Scheme == "https" && req.URL.Scheme == "http":
+		err = ErrRedirectDowngrade
+	case p.Check != nil:
+		err = p.Check(req, via)
+	}
+	if err != nil {
+		if err != http.ErrUseLastResponse {
+			bot.log().Warn("redirect refused", "url", req.URL.String(), "from", from.URL.String(), "err", err)
+		}
+		return err
+	}
+	bot.log().Info("redirect", "url", req.URL.String(), "from", from.URL.String(), "hops", len(via))
+	if stats, ok := req.Context().Value(statsKey).(*callStats); ok {
+		stats.redirects.Add(1)
+	}
+	bot.meter().Add(MetricRedirects, Labels{"host": req.URL.Host}, 1)
+	bot.history.Add(req.URL.String())
+	return nil
+}
+
+// isRedirect reports whether resp is a redirect that was not followed.
+func isRedirect(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return resp.Header.Get("Location") != ""
+	}
+	return false
+}
+
+// Location returns the resolved target of a redirect page, returned when
+// the RedirectPolicy does not follow redirects. The result is nil if the
+// page has no Location header.
+func (page *Page) Location() *url.URL {
+	if page == nil || page.resp == nil {
+		return nil
+	}
+	u, err := page.resp.Location()
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// Redirects returns the redirects followed to load the page,
+// starting from the original request.
+func (page *Page) Redirects() []Redirect {
+	if page == nil || page.resp == nil {
+		return nil
+	}
+	var chain []Redirect
+	for r := page.resp.Request; r != nil && r.Response != nil; r = r.Response.Request {
+		if r.Response.Request == nil {
+			break
+		}
+		chain = append([]Redirect{{URL: r.Response.Request.URL, StatusCode: r.Response.StatusCode}}, chain...)
+	}
+	return chain
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	other := bottest.NewSite().Page("/", "OTHER")
+	defer other.Close()
+	s := bottest.NewSite().
+		Page("/target/", "TARGET").
+		Redirect("/a/", "/b/", http.StatusMovedPermanently).
+		Redirect("/b/", "/target/", http.StatusFound).
+		Redirect("/other/", other.URL+"/", http.StatusFound)
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	page, err := b.GET("/a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "TARGET")
+	redirects := page.Redirects()
+	if len(redirects) != 2 {
+		t.Fatalf("Unexpected redirect chain: %v", redirects)
+	}
+	if redirects[0].URL.Path != "/a/" || redirects[0].StatusCode != http.StatusMovedPermanently ||
+		redirects[1].URL.Path != "/b/" || redirects[1].StatusCode != http.StatusFound {
+		t.Errorf("Unexpected redirect chain: %v", redirects)
+	}
+
+	b.SetRedirectPolicy(RedirectPolicy{MaxHops: 1})
+	if _, err := b.GET("/a/"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("Expected ErrTooManyRedirects, got %v", err)
+	}
+
+	b.SetRedirectPolicy(RedirectPolicy{SameHost: true})
+	if _, err := b.GET("/other/"); !errors.Is(err, ErrRedirectHost) {
+		t.Errorf("Expected ErrRedirectHost, got %v", err)
+	}
+
+	b.SetRedirectPolicy(RedirectPolicy{DontFollow: true})
+	page, err = b.GET("/a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, "without following redirects", page.resp, http.StatusMovedPermanently)
+	if loc := page.Location(); loc == nil || loc.String() != s.URL+"/b/" {
+		t.Errorf("Unexpected location: %v", loc)
+	}
+
+	// The request policy overrides the Bot policy
+	req, _ := http.NewRequest("GET", s.URL+"/a/", nil)
+	page, err = b.Do(WithRedirectPolicy(req, RedirectPolicy{
+		Check: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Path == "/b/" {
+				req.URL.Path = "/target/"
+			}
+			return nil
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "TARGET")
+	if h := b.History().Current(); h != s.URL+"/target/" {
+		t.Errorf("Unexpected history entry: %v", h)
+	}
+}
+
+func TestRedirectDowngrade(t *testing.T) {
+	p := RedirectPolicy{NoDowngrade: true}
+	b := New().SetRedirectPolicy(p)
+	from, _ := http.NewRequest("GET", "https://example.com/", nil)
+	to, _ := http.NewRequest("GET", "http://example.com/", nil)
+	if err := b.checkRedirect(to, []*http.Request{from}); err != ErrRedirectDowngrade {
+		t.Errorf("Expected ErrRedirectDowngrade, got %v", err)
+	}
+	to, _ = http.NewRequest("GET", "https://example.com/next", nil)
+	if err := b.checkRedirect(to, []*http.Request{from}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultReferrerPolicy is the policy used when the page does not
+// specify one, as in modern browsers.
+const DefaultReferrerPolicy = "strict-origin-when-cross-origin"
+
+// validReferrerPolicies are the policies defined by the Referrer Policy spec.
+var validReferrerPolicies = map[string]bool{
+	"no-referrer":                     true,
+	"no-referrer-when-downgrade":      true,
+	"origin":                          true,
+	"origin-when-cross-origin":        true,
+	"same-origin":                     true,
+	"strict-origin":                   true,
+	"strict-origin-when-cross-origin": true,
+	"unsafe-url":                      true,
+}
+
+// source is the page that originated a navigation.
+type source struct {
+	url    *url.URL
+	policy string
+}
+
+// WithReferer returns a shallow copy of req that is sent as if the
+// navigation started from the page at referer, instead of the last
+// page loaded by the Bot. If referer is empty, neither Referer nor
+// Origin headers are sent.
+func WithReferer(req *http.Request, referer string) *http.Request {
+	src := &source{policy: DefaultReferrerPolicy}
+	if referer != "" {
+		u, err := url.Parse(referer)
+		if err == nil {
+			src.url = u
+		}
+	}
+	return withSource(req, src)
+}
+
+// withSource returns a shallow copy of req with the navigation source.
+func withSource(req *http.Request, src *source) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), sourceKey, src))
+}
+
+// TrackReferer enables sending the Referer and Origin headers based on
+// the last page loaded by the Bot, respecting its Referrer-Policy.
+// It is enabled by default. Requests sent concurrently should set
+// their source with WithReferer, as the last page may have been loaded
+// by another goroutine. The Crawler and the Pager already do that.
+func (bot *Bot) TrackReferer(enabled bool) *Bot {
+	bot.referer = enabled
+	return bot
+}
+
+// URL returns the URL of the page, after following any redirects.
+// The result is nil if the page was not fetched by a Bot.
+func (page *Page) URL() *url.URL {
+	if page == nil || page.resp == nil || page.resp.Request == nil {
+		return nil
+	}
+	return page.resp.Request.URL
+}
+
+// ReferrerPolicy returns the page Referrer-Policy, from the response
+// header, or from the <meta name="referrer"> tag if the body was
+// already loaded. If none is valid, DefaultReferrerPolicy is returned.
+func (page *Page) ReferrerPolicy() string {
+	if page == nil || page.resp == nil {
+		return DefaultReferrerPolicy
+	}
+	policy := ""
+	// As in browsers, the last valid policy in the header is used.
+	for _, v := range strings.Split(page.resp.Header.Get("Referrer-Policy"), ",") {
+		if v = strings.ToLower(strings.TrimSpace(v)); validReferrerPolicies[v] {
+			policy = v
+		}
+	}
+	if v := page.metaReferrerPolicy(); v != "" {
+		policy = v
+	}
+	if policy == "" {
+		return DefaultReferrerPolicy
+	}
+	return policy
+}
+
+// metaReferrerPolicy returns the valid policy of the <meta name="referrer">
+// tag, if the body was already loaded. The body is parsed only once.
+func (page *Page) metaReferrerPolicy() string {
+	page.mu.Lock()
+	defer page.mu.Unlock()
+	if page.body == nil || page.policyParsed {
+		return page.policy
+	}
+	page.policyParsed = true
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page.body)); err == nil {
+		v := strings.ToLower(strings.TrimSpace(doc.Find(`meta[name="referrer"]`).Last().AttrOr("content", "")))
+		if validReferrerPolicies[v] {
+			page.policy = v
+		}
+	}
+	return page.policy
+}
+
+// setReferer sets the Referer and Origin headers of req, based on the
+// navigation source. Headers already present in req are preserved.
+func (bot *Bot) setReferer(req *http.Request) {
+	if !bot.referer {
+		return
+	}
+	src, _ := req.Context().Value(sourceKey).(*source)
+	if last := bot.history.last(); src == nil && last != nil {
+		src = &source{url: last.URL(), policy: last.ReferrerPolicy()}
+	}
+	if src == nil || src.url == nil {
+		return
+	}
+	if req.Header.Get("Referer") == "" {
+		if ref := referrer(src.url, req.URL, src.policy); ref != "" {
+			req.Header.Set("Referer", ref)
+		}
+	}
+	if req.Method != "GET" && req.Method != "HEAD" && req.Header.Get("Origin") == "" {
+		origin := origin(src.url)
+		if src.policy == "no-referrer" {
+			origin = "null"
+		}
+		req.Header.Set("Origin", origin)
+	}
+}
+
+// referrer returns the Referer sent when navigating from the page at
+// from to the URL to, according to the Referrer-Policy.
+func referrer(from, to *url.URL, policy string) string {
+	if from.Scheme != "http" && from.Scheme != "https" {
+		return ""
+	}
+	full := *from
+	full.Fragment = ""
+	full.User = nil
+	sameOrigin := origin(from) == origin(to)
+	downgrade := from.Scheme == "https" && to.Scheme != "https"
+	switch policy {
+	case "no-referrer":
+		return ""
+	case "no-referrer-when-downgrade":
+		if downgrade {
+			return ""
+		}
+		return full.String()
+	case "origin":
+		return origin(from) + "/"
+	case "origin-when-cross-origin":
+		if sameOrigin {
+			return full.String()
+		}
+		return origin(from) + "/"
+	case "same-origin":
+		if sameOrigin {
+			return full.String()
+		}
+		return ""
+	case "strict-origin":
+		if downgrade {
+			return ""
+		}
+		return origin(from) + "/"
+	case "unsafe-url":
+		return full.String()
+	}
+	// strict-origin-when-cross-origin
+	switch {
+	case sameOrigin:
+		return full.String()
+	case downgrade:
+		return ""
+	}
+	return origin(from) + "/"
+}
+
+// origin returns the serialized origin of the URL.
+func origin(u *url.URL) string {
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
@@ -0,0 +1,199 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// refreshURL matches the URL in a Refresh header or meta tag content,
+	// such as "0; url='/next'", and the delay in seconds, that is required.
+	refreshURL = regexp.MustCompile(`(?i)^\s*(\d+(?:\.\d*)?)\s*[;,]?\s*(?:url\s*=\s*)?(.*)$`)
+
+	// locationScript matches a statement with a simple JavaScript location
+	// assignment, such as window.location.href = "/next" or
+	// location.replace('/next').
+	locationScript = regexp.MustCompile(`^(?:(?:window|document|top|self)\.)?location(?:\.href)?\s*(?:=\s*|\.(?:replace|assign)\(\s*)["']([^"']+)["']`)
+)
+
+// RefreshURL returns the resolved target of a Refresh header,
+// a <meta http-equiv="refresh"> tag, or a simple JavaScript location
+// assignment in the page. The result is nil if the page does not
+// redirect, or only reloads itself.
+func (page *Page) RefreshURL() *url.URL {
+	u, _ := page.refresh()
+	return u
+}
+
+// refresh returns the resolved target of the page refresh, as in
+// RefreshURL, and its delay. Script redirects have no delay.
+func (page *Page) refresh() (*url.URL, time.Duration) {
+	base := page.URL()
+	if base == nil {
+		return nil, 0
+	}
+	target, delay := parseRefresh(page.resp.Header.Get("Refresh"))
+	if target == "" {
+		body, err := page.Bytes()
+		if err != nil {
+			return nil, 0
+		}
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, 0
+		}
+		doc.Find("meta[http-equiv]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+			if strings.EqualFold(s.AttrOr("http-equiv", ""), "refresh") {
+				target, delay = parseRefresh(s.AttrOr("content", ""))
+			}
+			return target == ""
+		})
+		if target == "" {
+			doc.Find("script:not([src])").EachWithBreak(func(i int, s *goquery.Selection) bool {
+				target, delay = scriptLocation(s.Text()), 0
+				return target == ""
+			})
+		}
+	}
+	if target == "" {
+		return nil, 0
+	}
+	u, err := base.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		page.log().Warn("parse warning: invalid refresh URL", "url", target, "err", err)
+		return nil, 0
+	}
+	if *u == *base {
+		return nil, 0
+	}
+	return u, delay
+}
+
+// scriptLocation returns the URL of the first location assignment that
+// is a top level statement of the script. Assignments inside functions,
+// blocks or conditionals are not run when the page loads, or may not
+// run at all, so they are ignored.
+func scriptLocation(script string) string {
+	depth := 0
+	// prev is the last character outside strings and comments.
+	var prev byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			for i++; i < len(script) && script[i] != c; i++ {
+				if script[i] == '\\' {
+					i++
+				}
+			}
+		case strings.HasPrefix(script[i:], "//"):
+			if n := strings.IndexByte(script[i:], '\n'); n >= 0 {
+				i += n
+			} else {
+				i = len(script)
+			}
+			continue
+		case strings.HasPrefix(script[i:], "/*"):
+			if n := strings.Index(script[i+2:], "*/"); n >= 0 {
+				i += n + 3
+			} else {
+				i = len(script)
+			}
+			continue
+		case c == '{' || c == '(' || c == '[':
+			depth++
+		case c == '}' || c == ')' || c == ']':
+			depth--
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case depth == 0 && (prev == 0 || prev == ';' || prev == '}'):
+			if m := locationScript.FindStringSubmatch(script[i:]); m != nil {
+				return m[1]
+			}
+		}
+		prev = c
+	}
+	return ""
+}
+
+// parseRefresh returns the URL in the Refresh content, if any,
+// and the refresh delay.
+func parseRefresh(content string) (string, time.Duration) {
+	m := refreshURL.FindStringSubmatch(content)
+	if m == nil {
+		return "", 0
+	}
+	seconds, _ := strconv.ParseFloat(m[1], 64)
+	// Clamp the delay to avoid overflows.
+	seconds = math.Min(seconds, math.MaxInt32)
+	return strings.Trim(strings.TrimSpace(m[2]), `"'`), time.Duration(seconds * float64(time.Second))
+}
+
+// followRefresh follows the meta refresh or JavaScript redirects in page,
+// when enabled in the RedirectPolicy. The redirects are checked as HTTP
+// redirects, counting toward the maximum number of hops.
+func (bot *Bot) followRefresh(req *http.Request, page *Page) (*Page, error) {
+	for policy := bot.redirectPolicy(req); policy.FollowRefresh && !isRedirect(page.resp); {
+		target, delay := page.refresh()
+		if target == nil {
+			break
+		}
+		maxDelay := policy.MaxRefreshDelay
+		if maxDelay == 0 {
+			maxDelay = DefaultMaxRefreshDelay
+		}
+		if delay > maxDelay {
+			bot.log().Debug("refresh not followed, delay too long", "url", page.URL().String(), "target", target.String(), "delay", delay)
+			break
+		}
+		via := requests(page.resp)
+		next, err := http.NewRequestWithContext(req.Context(), "GET", target.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		// Chain the responses, as in HTTP redirects, so that
+		// Page.Redirects includes this one.
+		next.Response = page.resp
+		next = withSource(next, &source{url: page.URL(), policy: page.ReferrerPolicy()})
+		if err := bot.checkRedirect(next, via); err != nil {
+			if err == http.ErrUseLastResponse {
+				break
+			}
+			return nil, &url.Error{Op: "Get", URL: target.String(), Err: err}
+		}
+		// Count the previous hops in HTTP redirects from next.
+		next = next.WithContext(context.WithValue(next.Context(), viaKey, via))
+		bot.setReferer(next)
+		if page, err = bot.send(next); err != nil {
+			return page, err
+		}
+		req = next
+	}
+	return page, nil
+}
+
+// requests returns the requests sent to obtain resp,
+// starting from the original request, and including any redirects.
+func requests(resp *http.Response) []*http.Request {
+	var result []*http.Request
+	for r := resp.Request; r != nil; {
+		result = append([]*http.Request{r}, result...)
+		if r.Response == nil {
+			break
+		}
+		r = r.Response.Request
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestParseRefresh(t *testing.T) {
+	for content, want := range map[string]struct {
+		url   string
+		delay time.Duration
+	}{
+		"0;url=/next":          {"/next", 0},
+		"0; URL='/next'":       {"/next", 0},
+		`3, url="/next?a=b"`:   {"/next?a=b", 3 * time.Second},
+		"1.5; url = /next":     {"/next", 1500 * time.Millisecond},
+		"5":                    {"", 5 * time.Second},
+		"":                     {"", 0},
+		"0;http://example.com": {"http://example.com", 0},
+		"abc":                  {"", 0},
+		"; url=/next":          {"", 0},
+	} {
+		if got, delay := parseRefresh(content); got != want.url || delay != want.delay {
+			t.Errorf("parseRefresh(%q) = %q, %v, want %q, %v", content, got, delay, want.url, want.delay)
+		}
+	}
+}
+
+func TestFollowRefresh(t *testing.T) {
+	s := bottest.NewSite().
+		Page("/meta/", `<html><head><meta http-equiv="Refresh" content="0;url=/script/"></head></html>`).
+		Page("/script/", `<html><script>window.location.href = '/redirect/';</script></html>`).
+		Redirect("/redirect/", "/target/", http.StatusFound).
+		Page("/target/", "TARGET").
+		Page("/ping/", `<meta http-equiv="refresh" content="0;url=/pong/">`).
+		Page("/pong/", `<meta http-equiv="refresh" content="0;url=/ping/">`).
+		Page("/self/", `<meta http-equiv="refresh" content="30">`).
+		Page("/home/", `<meta http-equiv="refresh" content="900;url=/logout/">HOME`).
+		Page("/logout/", "BYE")
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	page, err := b.GET("/meta/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := page.URL(); u.Path != "/meta/" {
+		t.Errorf("Refresh should not be followed by default, got %v", u)
+	}
+
+	b.SetRedirectPolicy(RedirectPolicy{FollowRefresh: true})
+	page, err = b.GET("/meta/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "TARGET")
+	var chain []string
+	for _, r := range page.Redirects() {
+		chain = append(chain, r.URL.Path)
+	}
+	if len(chain) != 3 || chain[0] != "/meta/" || chain[1] != "/script/" || chain[2] != "/redirect/" {
+		t.Errorf("Unexpected redirect chain: %v", chain)
+	}
+	h := b.History().Entries()
+	if len(h) < 4 || h[len(h)-1] != s.URL+"/target/" || h[len(h)-3] != s.URL+"/script/" {
+		t.Errorf("Unexpected history: %v", h)
+	}
+
+	// Refresh redirects count toward the limit
+	b.SetRedirectPolicy(RedirectPolicy{FollowRefresh: true, MaxHops: 2})
+	if _, err := b.GET("/meta/"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("Expected ErrTooManyRedirects, got %v", err)
+	}
+	b.SetRedirectPolicy(RedirectPolicy{FollowRefresh: true})
+	if _, err := b.GET("/ping/"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("Expected ErrTooManyRedirects, got %v", err)
+	}
+
+	// A page that only reloads itself is returned
+	page, err = b.GET("/self/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := page.URL(); u.Path != "/self/" {
+		t.Errorf("Unexpected page URL: %v", u)
+	}
+
+	// Long delays, such as session timeouts, are not followed
+	page, err = b.GET("/home/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := page.URL(); u.Path != "/home/" {
+		t.Errorf("Session timeout refresh should not be followed, got %v", u)
+	}
+	b.SetRedirectPolicy(RedirectPolicy{FollowRefresh: true, MaxRefreshDelay: time.Hour})
+	if page, err = b.GET("/home/"); err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "BYE")
+}
+
+func TestScriptLocation(t *testing.T) {
+	for script, want := range map[string]string{
+		`window.location.href = '/next';`:                                       "/next",
+		`var a = "{"; // location = '/comment'` + "\nlocation.replace('/next')": "/next",
+		`/* location = '/comment' */ top.location = "/next"`:                    "/next",
+		`function f() {} location.assign('/next')`:                              "/next",
+		`function logout(){location='/logout'}`:                                 "",
+		`if (expired) location = '/login';`:                                     "",
+		`if (expired) { location = '/login'; }`:                                 "",
+		`setTimeout(function() { location = '/later' }, 5000);`:                 "",
+		`button.onclick = function() { location = '/click'; };`:                 "",
+		`var next = 'location = "/string"';`:                                    "",
+	} {
+		if got := scriptLocation(script); got != want {
+			t.Errorf("scriptLocation(%q) = %q, want %q", script, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrNoSession is returned by Login when no session was configured
+// with SetSession.
+var ErrNoSession = errors.New("bot: no session configured")
+
+// LoginFunc authenticates the Bot, usually by posting a login form.
+// The Bot passed to the function shares all the state of the Bot
+// configured with SetSession, but never detects session expiry,
+// so the login requests are not retried.
+type LoginFunc func(bot *Bot) error
+
+// ExpiryDetector reports whether the page shows that the session
+// has expired. The page may have a non 2xx status code.
+type ExpiryDetector func(page *Page) bool
+
+// ExpiredOnStatus detects session expiry by the response status code,
+// such as http.StatusUnauthorized.
+func ExpiredOnStatus(codes ...int) ExpiryDetector {
+	return func(page *Page) bool {
+		for _, code := range codes {
+			if page.resp.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ExpiredOnRedirect detects session expiry when the request is
+// redirected to the login URL. The loginURL can be relative to the
+// page URL, and only its host and path are compared.
+func ExpiredOnRedirect(loginURL string) ExpiryDetector {
+	return func(page *Page) bool {
+		target := page.Location()
+		if target == nil {
+			if len(page.Redirects()) == 0 {
+				return false
+			}
+			target = page.URL()
+		}
+		login, err := target.Parse(loginURL)
+		if err != nil {
+			return false
+		}
+		return login.Host == target.Host && login.Path == target.Path
+	}
+}
+
+// ExpiredOnSelector detects session expiry when the page has elements
+// matching the CSS selector, such as "form#login".
+func ExpiredOnSelector(selector string) ExpiryDetector {
+	return func(page *Page) bool {
+		body, err := page.Bytes()
+		if err != nil {
+			return false
+		}
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+		return doc.Find(selector).Length() > 0
+	}
+}
+
+// session holds the login function and the expiry detectors.
+type session struct {
+	login   LoginFunc
+	expired []ExpiryDetector
+
+	// mu serializes logins, and gen counts the successful ones,
+	// so requests that detected the same expiry log in only once.
+	mu  sync.Mutex
+	gen uint64
+}
+
+// SetSession configures the Bot to log in again with login when any of
+// the detectors reports that the session expired. The Bot logs in only
+// once, even when concurrent requests detect the expiry, and then sends
+// the original request again. Each request is retried at most once.
+//
+// The Bot does not log in until an expiry is detected, or Login is called.
+func (bot *Bot) SetSession(login LoginFunc, detectors ...ExpiryDetector) *Bot {
+	bot.session = &session{login: login, expired: detectors}
+	return bot
+}
+
+// Login calls the login function configured with SetSession.
+func (bot *Bot) Login() error {
+	s := bot.session
+	if s == nil {
+		return ErrNoSession
+	}
+	return s.relogin(bot, s.generation())
+}
+
+// generation returns the number of successful logins.
+func (s *session) generation() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gen
+}
+
+// isExpired reports whether any detector matches the page.
+func (s *session) isExpired(page *Page) bool {
+	for _, expired := range s.expired {
+		if expired(page) {
+			return true
+		}
+	}
+	return false
+}
+
+// relogin calls the login function, unless another login succeeded
+// after the generation gen.
+func (s *session) relogin(bot *Bot, gen uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen != gen {
+		return nil
+	}
+	bot.log().Info("login")
+	// The login requests are flagged in their context, so they are
+	// not retried when they detect the session expiry.
+	ctx := context.WithValue(bot.context(), loginKey, true)
+	if err := s.login(bot.WithContext(ctx)); err != nil {
+		bot.log().Warn("login failed", "err", err)
+		return err
+	}
+	s.gen++
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestSession(t *testing.T) {
+	var s *bottest.Site
+	s = bottest.NewSite().
+		Login("/login/", url.Values{"user": {"bot"}, "pass": {"secret"}}).
+		Private("/private/", "PRIVATE").
+		HandleFunc("/account/", func(w http.ResponseWriter, r *http.Request) {
+			if !s.LoggedIn(r) {
+				http.Redirect(w, r, "/login/?next=/account/", http.StatusFound)
+				return
+			}
+			w.Write([]byte("ACCOUNT"))
+		})
+	defer s.Close()
+
+	var logins int32
+	b := New().BaseURL(s.URL)
+	if err := b.Login(); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Expected ErrNoSession, got %v", err)
+	}
+	b.SetSession(func(b *Bot) error {
+		atomic.AddInt32(&logins, 1)
+		_, err := b.POST("/login/", url.Values{"user": {"bot"}, "pass": {"secret"}})
+		return err
+	}, ExpiredOnStatus(http.StatusForbidden), ExpiredOnRedirect("/login/"))
+
+	// The first request logs in
+	page, err := b.GET("/private/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "PRIVATE")
+	if logins != 1 {
+		t.Errorf("Expected 1 login, got %d", logins)
+	}
+
+	// Concurrent requests log in only once
+	s.Logout()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			page, err := b.GET("/private/")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			checkBody(t, page, "PRIVATE")
+		}()
+	}
+	wg.Wait()
+	if logins != 2 {
+		t.Errorf("Expected 2 logins, got %d", logins)
+	}
+
+	// Redirects to the login page are detected
+	s.Logout()
+	page, err = b.GET("/account/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "ACCOUNT")
+	if logins != 3 {
+		t.Errorf("Expected 3 logins, got %d", logins)
+	}
+}
+
+func TestSessionLoginFailure(t *testing.T) {
+	s := bottest.NewSite().
+		Login("/login/", url.Values{"user": {"bot"}}).
+		Private("/private/", "PRIVATE")
+	defer s.Close()
+
+	var logins int32
+	b := New().BaseURL(s.URL).SetSession(func(b *Bot) error {
+		atomic.AddInt32(&logins, 1)
+		_, err := b.POST("/login/", url.Values{"user": {"invalid"}})
+		return err
+	}, ExpiredOnStatus(http.StatusForbidden))
+	if _, err := b.GET("/private/"); err == nil {
+		t.Errorf("Expected an error when login fails")
+	}
+	if logins != 1 {
+		t.Errorf("Expected 1 login, got %d", logins)
+	}
+}
+
+func TestSessionRequestBody(t *testing.T) {
+	s := bottest.NewSite().
+		Login("/login/", url.Values{"user": {"bot"}}).
+		Private("/private/", "PRIVATE")
+	defer s.Close()
+
+	b := New().BaseURL(s.URL).SetSession(func(b *Bot) error {
+		_, err := b.POST("/login/", url.Values{"user": {"bot"}})
+		return err
+	}, ExpiredOnStatus(http.StatusForbidden))
+	if err := b.Login(); err != nil {
+		t.Fatal(err)
+	}
+	post := func() (*Page, error) {
+		// A body without GetBody can not be sent again
+		body := io.NopCloser(strings.NewReader("q=1"))
+		req, err := http.NewRequest("POST", s.URL+"/private/", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b.Do(req)
+	}
+	page, err := post()
+	if err != nil {
+		t.Fatalf("Unexpected error while the session is valid: %v", err)
+	}
+	checkBody(t, page, "PRIVATE")
+
+	s.Logout()
+	if _, err := post(); err == nil || !strings.Contains(err.Error(), "unable to resend") {
+		t.Errorf("Expected an error resending the body, got %v", err)
+	}
+}
+
+func TestExpiredOnSelector(t *testing.T) {
+	expired := ExpiredOnSelector("form#login")
+	if !expired(samplePage(t, `<html><form id="login"></form></html>`)) {
+		t.Errorf("Expected session expired")
+	}
+	if expired(samplePage(t, `<html><form id="search"></form></html>`)) {
+		t.Errorf("Unexpected session expired")
+	}
+}
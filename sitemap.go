@@ -0,0 +1,247 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSitemaps is the maximum number of sitemap files loaded by Sitemap,
+// including the ones listed in sitemap indexes.
+const MaxSitemaps = 1000
+
+// ErrNotSitemap is returned when a document is not a sitemap urlset
+// or sitemap index.
+var ErrNotSitemap = errors.New("bot: not a sitemap")
+
+// SitemapURL is an URL listed in a sitemap.
+type SitemapURL struct {
+	// Loc is the page URL.
+	Loc string
+
+	// LastMod is the last modification time of the page,
+	// or the zero time if not informed.
+	LastMod time.Time
+
+	// ChangeFreq is how frequently the page changes, such as "daily".
+	ChangeFreq string
+
+	// Priority is the page priority, from 0.0 to 1.0,
+	// or zero if not informed.
+	Priority float64
+}
+
+// xmlSitemap is either a <urlset> or a <sitemapindex>.
+type xmlSitemap struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc        string `xml:"loc"`
+		LastMod    string `xml:"lastmod"`
+		ChangeFreq string `xml:"changefreq"`
+		Priority   string `xml:"priority"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// DiscoverSitemaps returns the sitemaps of the site, listed in the
+// Sitemap lines of its robots.txt. If there are none, the default
+// /sitemap.xml is returned if it exists. The site URL is prefixed with
+// the Bot BaseURL, as in GET, and only its scheme and host are used.
+func (bot *Bot) DiscoverSitemaps(site string) ([]string, error) {
+	u, err := url.Parse(bot.b + site)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("bot: invalid site URL: %q", u.String())
+	}
+	root := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+
+	var sitemaps []string
+	robots := root.ResolveReference(&url.URL{Path: "/robots.txt"})
+	page, err := bot.fetch(robots.String())
+	if err == nil {
+		body, err := page.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		s := bufio.NewScanner(bytes.NewReader(body))
+		for s.Scan() {
+			line := s.Text()
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			key, value, ok := strings.Cut(line, ":")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+				continue
+			}
+			if loc, err := robots.Parse(strings.TrimSpace(value)); err == nil {
+				sitemaps = append(sitemaps, loc.String())
+			}
+		}
+	} else if !isStatusError(err) {
+		return nil, err
+	}
+	if len(sitemaps) > 0 {
+		return sitemaps, nil
+	}
+
+	def := root.ResolveReference(&url.URL{Path: "/sitemap.xml"})
+	page, err = bot.fetch(def.String())
+	if isStatusError(err) {
+		// Not found, or not allowed.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	// Only the existence of the sitemap is checked.
+	page.discard()
+	return []string{def.String()}, nil
+}
+
+// Sitemap loads the sitemap at the URL, and returns the URLs it lists.
+// Sitemap indexes are followed, and the URLs of all their sitemaps are
+// returned, up to MaxSitemaps files. Sitemaps can be gzipped. The URL is
+// prefixed with the Bot BaseURL, as in GET.
+func (bot *Bot) Sitemap(url string) ([]SitemapURL, error) {
+	var (
+		urls  []SitemapURL
+		queue = []string{bot.b + url}
+		seen  = map[string]bool{queue[0]: true}
+	)
+	for n := 0; len(queue) > 0; n++ {
+		if n >= MaxSitemaps {
+			bot.log().Warn("too many sitemaps, skipping", "skipped", len(queue))
+			break
+		}
+		loc := queue[0]
+		queue = queue[1:]
+		page, err := bot.fetch(loc)
+		if err != nil {
+			return urls, err
+		}
+		body, err := page.Bytes()
+		if err != nil {
+			return urls, err
+		}
+		sm, err := parseSitemap(body)
+		if err != nil {
+			return urls, fmt.Errorf("bot: unable to parse sitemap %s: %w", loc, err)
+		}
+		for _, s := range sm.Sitemaps {
+			child, err := page.URL().Parse(strings.TrimSpace(s.Loc))
+			if err != nil {
+				bot.log().Warn("parse warning: invalid sitemap loc", "sitemap", loc, "loc", s.Loc, "err", err)
+				continue
+			}
+			if !seen[child.String()] {
+				seen[child.String()] = true
+				queue = append(queue, child.String())
+			}
+		}
+		for _, u := range sm.URLs {
+			entry := SitemapURL{
+				Loc:        strings.TrimSpace(u.Loc),
+				ChangeFreq: strings.TrimSpace(u.ChangeFreq),
+			}
+			if u.LastMod != "" {
+				if entry.LastMod, err = parseTime(u.LastMod); err != nil {
+					bot.log().Warn("parse warning: invalid sitemap lastmod", "loc", entry.Loc, "lastmod", u.LastMod)
+				}
+			}
+			if u.Priority != "" {
+				entry.Priority, _ = strconv.ParseFloat(strings.TrimSpace(u.Priority), 64)
+			}
+			urls = append(urls, entry)
+		}
+	}
+	return urls, nil
+}
+
+// parseSitemap parses a sitemap urlset or index, gzipped or not.
+func parseSitemap(body []byte) (*xmlSitemap, error) {
+	body, err := gunzip(body)
+	if err != nil {
+		return nil, err
+	}
+	sm := new(xmlSitemap)
+	if err := xml.Unmarshal(body, sm); err != nil {
+		return nil, err
+	}
+	if sm.XMLName.Local != "urlset" && sm.XMLName.Local != "sitemapindex" {
+		return nil, ErrNotSitemap
+	}
+	return sm, nil
+}
+
+// gunzip decompresses the body if it starts with the gzip magic number.
+// Gzipped files are usually served without a Content-Encoding, so they
+// are not decompressed by the transport.
+func gunzip(body []byte) ([]byte, error) {
+	if len(body) < 2 || body[0] != 0x1f || body[1] != 0x8b {
+		return body, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// isStatusError reports whether err is a StatusError.
+func isStatusError(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se)
+}
+
+// fetch loads the absolute URL with a GET request.
+func (bot *Bot) fetch(url string) (*Page, error) {
+	req, err := http.NewRequestWithContext(bot.context(), "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return bot.Do(req)
+}
+
+// timeLayouts are the date formats found in sitemaps and feeds.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+}
+
+// parseTime parses a W3C datetime, as used in sitemaps and Atom, or
+// an RFC 822 date, as used in RSS.
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bot: invalid time: %q", s)
+}
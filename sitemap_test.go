@@ -0,0 +1,105 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestSitemap(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/b</loc></url>
+</urlset>`)
+	w.Close()
+
+	var s *bottest.Site
+	s = bottest.NewSite().
+		HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private/\n\nSitemap: %s/index.xml # main\nsitemap: /missing.xml\n", s.URL)
+		}).
+		Page("/index.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>/pages.xml</loc><lastmod>2015-01-02</lastmod></sitemap>
+  <sitemap><loc>/more.xml.gz</loc></sitemap>
+  <sitemap><loc>/index.xml</loc></sitemap>
+</sitemapindex>`).
+		Page("/pages.xml", `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>https://example.com/a</loc>
+    <lastmod>2015-03-04T05:06:07+00:00</lastmod>
+    <changefreq>daily</changefreq>
+    <priority>0.8</priority>
+  </url>
+</urlset>`).
+		HandleFunc("/more.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write(gz.Bytes())
+		})
+	defer s.Close()
+
+	b := New().BaseURL(s.URL)
+	sitemaps, err := b.DiscoverSitemaps("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sitemaps) != 2 || sitemaps[0] != s.URL+"/index.xml" || sitemaps[1] != s.URL+"/missing.xml" {
+		t.Errorf("Unexpected sitemaps discovered: %v", sitemaps)
+	}
+
+	urls, err := b.Sitemap("/index.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 2 {
+		t.Fatalf("Expected 2 URLs, got %v", urls)
+	}
+	want := SitemapURL{
+		Loc:        "https://example.com/a",
+		LastMod:    time.Date(2015, 3, 4, 5, 6, 7, 0, time.UTC),
+		ChangeFreq: "daily",
+		Priority:   0.8,
+	}
+	if got := urls[0]; got.Loc != want.Loc || !got.LastMod.Equal(want.LastMod) || got.ChangeFreq != want.ChangeFreq || got.Priority != want.Priority {
+		t.Errorf("Unexpected URL: %+v, want %+v", got, want)
+	}
+	if urls[1].Loc != "https://example.com/b" {
+		t.Errorf("Unexpected gzipped URL: %+v", urls[1])
+	}
+
+	if _, err := b.Sitemap("/robots.txt"); err == nil {
+		t.Errorf("Expected an error parsing a non sitemap")
+	}
+}
+
+func TestDiscoverDefaultSitemap(t *testing.T) {
+	s := bottest.NewSite().
+		Error("/robots.txt", http.StatusNotFound, "Not Found").
+		Page("/sitemap.xml", `<urlset></urlset>`)
+	defer s.Close()
+
+	sitemaps, err := New().DiscoverSitemaps(s.URL + "/some/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sitemaps) != 1 || sitemaps[0] != s.URL+"/sitemap.xml" {
+		t.Errorf("Unexpected sitemaps discovered: %v", sitemaps)
+	}
+
+	empty := bottest.NewSite().Error("/", http.StatusNotFound, "Not Found")
+	defer empty.Close()
+	if sitemaps, err = New().DiscoverSitemaps(empty.URL); err != nil || len(sitemaps) != 0 {
+		t.Errorf("Expected no sitemaps, got %v, %v", sitemaps, err)
+	}
+}
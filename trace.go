@@ -0,0 +1,109 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// Call is the result of a call to Do, reported to a CallObserver.
+type Call struct {
+	// Request is the request passed to Do, as returned by the observer.
+	Request *http.Request
+
+	// StatusCode is the status code of the last response, or zero if
+	// there was a network error.
+	StatusCode int
+
+	// URL is the URL of the last response, after redirects.
+	URL *url.URL
+
+	// ContentLength is the length of the last response body,
+	// or -1 if unknown.
+	ContentLength int64
+
+	// Redirects and Retries are the number of redirects followed,
+	// and of requests sent again, such as after a login.
+	Redirects, Retries int
+
+	// Err is the error returned by Do.
+	Err error
+}
+
+// CallObserver is notified of each call to Do, and of the methods that
+// use it, such as GET and POST, to trace or time them. It receives the
+// context set with WithContext, or context.Background, and the request,
+// and returns the request to send, such as with a span in its context,
+// and a function called with the result of the call.
+// The bottrace package provides an OpenTelemetry CallObserver.
+type CallObserver func(ctx context.Context, req *http.Request) (*http.Request, func(*Call))
+
+// ObserveCalls configures the observer notified of each call to Do.
+// Passing nil disables it.
+func (bot *Bot) ObserveCalls(o CallObserver) *Bot {
+	bot.observer = o
+	return bot
+}
+
+// callStats are counted during a call to Do, and reported to the
+// CallObserver.
+type callStats struct {
+	redirects atomic.Int64
+	retries   atomic.Int64
+}
+
+// WithContext returns a shallow copy of the Bot, that uses ctx in the
+// requests made by its methods, such as GET and POST, and passes it to
+// the CallObserver. The copy shares the cookies, history and all other
+// state with bot:
+//
+//	ctx, span := tracer.Start(ctx, "checkout")
+//	defer span.End()
+//	page, err := b.WithContext(ctx).GET("/cart/")
+func (bot *Bot) WithContext(ctx context.Context) *Bot {
+	b := *bot
+	b.ctx = ctx
+	return &b
+}
+
+// context returns the context of the requests made by the Bot methods.
+func (bot *Bot) context() context.Context {
+	if bot != nil && bot.ctx != nil {
+		return bot.ctx
+	}
+	return context.Background()
+}
+
+// observe sends the request, notifying the CallObserver.
+func (bot *Bot) observe(req *http.Request) (*Page, error) {
+	if bot.observer == nil {
+		return bot.do(req)
+	}
+	req, done := bot.observer(bot.context(), req)
+	stats := &callStats{}
+	req = req.WithContext(context.WithValue(req.Context(), statsKey, stats))
+	page, err := bot.do(req)
+	call := &Call{
+		Request:       req,
+		ContentLength: -1,
+		Redirects:     int(stats.redirects.Load()),
+		Retries:       int(stats.retries.Load()),
+		Err:           err,
+	}
+	var se *StatusError
+	switch {
+	case page != nil:
+		call.StatusCode = page.resp.StatusCode
+		call.URL = page.URL()
+		call.ContentLength = page.resp.ContentLength
+	case errors.As(err, &se):
+		call.StatusCode = se.StatusCode
+	}
+	done(call)
+	return page, err
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestObserveCalls(t *testing.T) {
+	s := bottest.NewSite().
+		Redirect("/old/", "/page/", http.StatusFound).
+		Page("/page/", "PAGE").
+		Login("/login/", nil).
+		Private("/private/", "PRIVATE")
+	defer s.Close()
+
+	type key struct{}
+	var calls []*Call
+	b := New().BaseURL(s.URL).
+		ObserveCalls(func(ctx context.Context, req *http.Request) (*http.Request, func(*Call)) {
+			if ctx.Value(key{}) != "workflow" {
+				t.Errorf("Expected the context of WithContext, got %v", ctx)
+			}
+			return req, func(c *Call) { calls = append(calls, c) }
+		}).
+		SetSession(func(b *Bot) error {
+			_, err := b.POST("/login/", url.Values{})
+			return err
+		}, ExpiredOnStatus(http.StatusForbidden))
+	b = b.WithContext(context.WithValue(context.Background(), key{}, "workflow"))
+
+	if _, err := b.GET("/old/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GET("/private/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GET("/missing/"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	var got []string
+	for _, c := range calls {
+		got = append(got, fmt.Sprintf("%s %s %d %v %d %d %v",
+			c.Request.Method, c.Request.URL.Path, c.StatusCode, c.URL, c.Redirects, c.Retries, c.Err != nil))
+	}
+	want := []string{
+		"GET /old/ 200 " + s.URL + "/page/ 1 0 false",
+		"POST /login/ 200 " + s.URL + "/login/ 0 0 false",
+		"GET /private/ 200 " + s.URL + "/private/ 0 1 false",
+		"GET /missing/ 404 <nil> 0 0 true",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Unexpected calls:\n%v, want\n%v", got, want)
+	}
+}
+
+func TestWithContextCanceled(t *testing.T) {
+	s := newListingSite(func(page int) int { return page + 1 }).
+		HandleFunc("/default.aspx", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, webFormsPage)
+		})
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := New().BaseURL(s.URL).WithContext(ctx)
+	list, err := b.GET("/list/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	search, err := b.GET("/search/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aspx, err := b.GET("/default.aspx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// The requests made from the pages use the context of their Bot.
+	for name, next := range map[string]func() (*http.Request, error){
+		"NextLink": func() (*http.Request, error) { return NextLink("a")(list) },
+		"NextForm": func() (*http.Request, error) { return NextForm("input[name=next]", nil)(search) },
+	} {
+		req, err := next()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if req.Context().Err() == nil {
+			t.Errorf("%s: expected the request to use the canceled context", name)
+		}
+	}
+	if _, err := b.PostBack(aspx, "Main_Next", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected PostBack to be canceled, got %v", err)
+	}
+	if _, err := b.DoPostBack(aspx, "ctl00$Main$Grid", "Page$2", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected DoPostBack to be canceled, got %v", err)
+	}
+}
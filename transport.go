@@ -4,11 +4,13 @@
 package bot
 
 import (
-	"log"
 	"net/http"
-	"net/http/httputil"
+	"time"
 )
 
+// DefaultUserAgent is the User-Agent sent when none is set with Bot.SetUA.
+const DefaultUserAgent = "Mozilla/5.0 (compatible)"
+
 // request is a http.Request wrapper to add some helper functions
 type request struct {
 	*http.Request
@@ -25,37 +27,121 @@ func (r *request) setUserAgent(ua string) {
 	r.header().Set("User-Agent", ua)
 }
 
+// RoundTripperFunc is an adapter to allow the use of ordinary
+// functions as an http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(r).
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Middleware wraps the next http.RoundTripper in the Bot transport chain.
+// A middleware can change the request before calling next, and inspect,
+// replace or retry the response after it returns.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Use appends the middlewares to the Bot transport chain.
+// Requests pass through the middlewares in the order they were added,
+// after the default headers and CSRF tokens are set and before the
+// request is served from the cache, authenticated, dumped or recorded.
+// Use is not safe to call while the Bot is sending requests.
+func (bot *Bot) Use(mw ...Middleware) *Bot {
+	bot.middlewares = append(bot.middlewares, mw...)
+	return bot
+}
+
 // transport type implements http.RoundTripper in order to allow
 // doing some magic in the Bot requests.
 type transport struct {
-	t  http.RoundTripper
-	ua string
-	b  *Bot
-}
-
-func (t *transport) userAgent() string {
-	if t.ua == "" {
-		return "Mozilla/5.0 (compatible)"
-	}
-	return t.ua
+	t http.RoundTripper
+	b *Bot
 }
 
 // RoundTrip implements the http.RoundTripper interface.
 func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
-	if t.b.debug {
-		b, _ := httputil.DumpRequest(r, true)
-		log.Printf("> Dumped request: \n>>>\n%s\n>>>\n", string(b))
+	return t.chain().RoundTrip(r)
+}
+
+// chain builds the transport chain, from the outermost middleware to
+// the underlying RoundTripper. The built-in middlewares are, in order:
+// logging, default headers, CSRF tokens, the middlewares from Bot.Use,
+// caching, authentication, proxy rotation, metrics, dumping,
+// HAR recording and cassettes.
+func (t *transport) chain() http.RoundTripper {
+	mws := []Middleware{t.b.logRequests, t.b.setHeaders, t.b.injectCSRF}
+	mws = append(mws, t.b.middlewares...)
+	mws = append(mws, t.b.cacheResponses, t.b.authenticate, t.b.rotateProxies,
+		t.b.measureRequests, t.b.dumpRequests, t.b.recordHAR, t.b.playCassette)
+	next := t.t
+	for i := len(mws) - 1; i >= 0; i-- {
+		next = mws[i](next)
 	}
-	req := &request{Request: r}
-	req.setUserAgent(t.userAgent())
-	resp, err := t.t.RoundTrip(req.Request)
-	if t.b.debug {
+	return next
+}
+
+// logRequests logs the start and end of each request.
+func (bot *Bot) logRequests(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		logger := bot.log()
+		logger.Debug("request start", "method", r.Method, "url", r.URL.String())
+		start := time.Now()
+		resp, err := next.RoundTrip(r)
+		if err != nil {
+			logger.Warn("request failed", "method", r.Method, "url", r.URL.String(),
+				"duration", time.Since(start), "err", err)
+			return resp, err
+		}
+		logger.Info("request end", "method", r.Method, "url", r.URL.String(),
+			"status", resp.StatusCode, "duration", time.Since(start))
+		return resp, err
+	})
+}
+
+// dumpRequests dumps requests and responses when debugging is enabled.
+func (bot *Bot) dumpRequests(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		d := bot.dumper()
+		if d == nil {
+			return next.RoundTrip(r)
+		}
+		logger := bot.log()
+		w, done, err := d.open(bot, r)
+		if err != nil {
+			logger.Warn("unable to dump request", "url", r.URL.String(), "err", err)
+			return next.RoundTrip(r)
+		}
+		defer done()
+		if err := d.dumpRequest(w, bot, r); err != nil {
+			logger.Warn("unable to dump request", "url", r.URL.String(), "err", err)
+		}
+		resp, err := next.RoundTrip(r)
 		if resp != nil {
-			b, _ := httputil.DumpResponse(resp, false)
-			log.Printf("Dumped response: \n<<<\n%s\n<<<\n", string(b))
-		} else {
-			log.Printf("Dumped response: \n<<<\n(nil): err=%v\n<<<\n", err)
+			if err := d.dumpResponse(w, resp); err != nil {
+				logger.Warn("unable to dump response", "url", r.URL.String(), "err", err)
+			}
 		}
-	}
-	return resp, err
+		return resp, err
+	})
+}
+
+// recordHAR records requests with the HARRecorder set with Bot.RecordHAR.
+func (bot *Bot) recordHAR(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if bot.har == nil {
+			return next.RoundTrip(r)
+		}
+		return bot.har.roundTrip(next, r)
+	})
+}
+
+// playCassette records or replays requests with the Cassette
+// set with Bot.UseCassette.
+func (bot *Bot) playCassette(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if bot.cassette == nil {
+			return next.RoundTrip(r)
+		}
+		return bot.cassette.roundTrip(bot, next, r)
+	})
 }
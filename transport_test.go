@@ -0,0 +1,45 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestMiddlewares(t *testing.T) {
+	site := bottest.NewSite().Page("/", "OK")
+	defer site.Close()
+
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				calls = append(calls, name+":"+r.Header.Get("User-Agent"))
+				r.Header.Add("X-Chain", name)
+				resp, err := next.RoundTrip(r)
+				calls = append(calls, name+":done")
+				return resp, err
+			})
+		}
+	}
+	b := New().SetUA("TestBot/1.0").Use(mw("first"), mw("second"))
+	page, err := b.GET(site.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBody(t, page, "OK")
+
+	expected := "first:TestBot/1.0,second:TestBot/1.0,second:done,first:done"
+	if got := strings.Join(calls, ","); got != expected {
+		t.Errorf("Unexpected middleware calls: %s, expected %s", got, expected)
+	}
+	sub, _ := site.LastSubmission("/")
+	if got := strings.Join(sub.Header["X-Chain"], ","); got != "first,second" {
+		t.Errorf("Unexpected X-Chain headers: %s", got)
+	}
+}
@@ -0,0 +1,462 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxDiffLines is the maximum product of the number of changed lines in
+// both versions for which a line by line diff is computed. Larger changes
+// are reported as all lines removed, then all lines added.
+const maxDiffLines = 1 << 20
+
+// Watcher detects changes in the content of pages fetched repeatedly,
+// such as prices or statuses. The last version of each page is kept in
+// a CacheStore, so a MemoryCache or a DiskCache can be used, the latter
+// to compare pages between runs.
+type Watcher struct {
+	// Store is where the last version of each page is kept.
+	Store CacheStore
+
+	// Selector, if not empty, restricts the comparison to the first
+	// element matching the CSS selector, such as "#prices".
+	// By default, the whole <body> is compared. Pages without a match
+	// are reported as an error.
+	Selector string
+
+	// Ignore are CSS selectors of volatile elements removed before the
+	// comparison, such as ".timestamp" or "#ads".
+	Ignore []string
+
+	// IgnorePatterns are removed from the text before the comparison,
+	// such as regexp.MustCompile(`\d{2}:\d{2}:\d{2}`).
+	IgnorePatterns []*regexp.Regexp
+}
+
+// NewWatcher returns a Watcher that keeps page versions in the store.
+func NewWatcher(store CacheStore) *Watcher {
+	return &Watcher{Store: store}
+}
+
+// Snapshot is the content of a page compared by a Watcher.
+type Snapshot struct {
+	URL string `json:"url"`
+
+	// Fingerprint is the SHA-256 hash of the Text and Tables.
+	Fingerprint string `json:"fingerprint"`
+
+	// Text has a line for each block of text.
+	Text []string `json:"text"`
+
+	// Tables are the tables, as returned by Page.Tables,
+	// without RawCells.
+	Tables []Table `json:"tables,omitempty"`
+
+	// Time is when the snapshot was taken.
+	Time time.Time `json:"time"`
+}
+
+// DiffOp tells if a line was added or removed.
+type DiffOp int
+
+const (
+	DiffRemoved DiffOp = iota + 1
+	DiffAdded
+)
+
+// TextChange is a line of text added or removed.
+type TextChange struct {
+	Op   DiffOp
+	Text string
+}
+
+// CellChange is a table cell changed in a row found in both versions.
+type CellChange struct {
+	// Table is the index of the table in the compared region,
+	// and Row and Col are the indexes of the cell in the Data of
+	// the current table.
+	Table, Row, Col int
+
+	// Header is the text of the column header, if any.
+	Header string
+
+	Old, New string
+}
+
+// RowChange is a table row added or removed.
+type RowChange struct {
+	Op DiffOp
+
+	// Table is the index of the table in the compared region, and Row
+	// is the index of the row in the Data of the current table, for
+	// added rows, or of the previous table, for removed rows.
+	Table, Row int
+
+	// Cells are the text of the row cells.
+	Cells []string
+}
+
+// Changes is the result of comparing a page with its last version.
+type Changes struct {
+	// Previous is the last version of the page, or nil if the page
+	// was not seen before. Current is the new version.
+	Previous *Snapshot
+	Current  *Snapshot
+
+	// Text are the lines added and removed, in document order.
+	Text []TextChange
+
+	// Cells are the table cells changed, and Rows are the table rows
+	// added or removed. Rows are aligned by their content, so a row
+	// inserted in a table does not change the cells of the next rows.
+	Cells []CellChange
+	Rows  []RowChange
+}
+
+// Changed reports whether the page changed since the last version.
+// Pages not seen before are not changed.
+func (c *Changes) Changed() bool {
+	return c.Previous != nil && c.Previous.Fingerprint != c.Current.Fingerprint
+}
+
+// Snapshot extracts the content of the page compared by the Watcher,
+// without storing it.
+func (w *Watcher) Snapshot(page *Page) (*Snapshot, error) {
+	doc, err := page.document()
+	if err != nil {
+		return nil, err
+	}
+	region := doc.Find("body").First()
+	if region.Length() == 0 {
+		region = doc.Selection
+	}
+	if w.Selector != "" {
+		region = doc.Find(w.Selector).First()
+		if region.Length() == 0 {
+			return nil, fmt.Errorf("bot: selector %q matches nothing in %v", w.Selector, page.URL())
+		}
+	}
+	region.Find("script, style, noscript, template").Remove()
+	for _, sel := range w.Ignore {
+		region.Find(sel).Remove()
+	}
+	s := &Snapshot{Time: time.Now()}
+	if u := page.URL(); u != nil {
+		s.URL = u.String()
+	}
+	var line []string
+	flush := func() {
+		if text := w.clean(strings.Join(line, " ")); text != "" {
+			s.Text = append(s.Text, text)
+		}
+		line = line[:0]
+	}
+	var walk func(*goquery.Selection)
+	walk = func(sel *goquery.Selection) {
+		sel.Contents().Each(func(i int, n *goquery.Selection) {
+			name := goquery.NodeName(n)
+			switch {
+			case name == "#text":
+				line = append(line, n.Text())
+			case blockElements[name]:
+				flush()
+				walk(n)
+				flush()
+			default:
+				walk(n)
+			}
+		})
+	}
+	walk(region)
+	flush()
+
+	// Reuse Page.Tables to parse the tables in the region.
+	if region.Length() > 0 {
+		html, err := goquery.OuterHtml(region)
+		if err != nil {
+			return nil, err
+		}
+		tables, err := (&Page{resp: page.resp, body: []byte(html), bot: page.bot}).Tables()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tables {
+			t.RawCells = nil
+			for i, h := range t.Header {
+				t.Header[i] = w.clean(h)
+			}
+			for _, row := range t.Data {
+				for i, cell := range row {
+					row[i] = w.clean(cell)
+				}
+			}
+			s.Tables = append(s.Tables, t)
+		}
+	}
+
+	h := sha256.New()
+	json.NewEncoder(h).Encode([]interface{}{s.Text, s.Tables})
+	s.Fingerprint = hex.EncodeToString(h.Sum(nil))
+	return s, nil
+}
+
+// clean removes the IgnorePatterns and collapses spaces in text.
+func (w *Watcher) clean(text string) string {
+	for _, re := range w.IgnorePatterns {
+		text = re.ReplaceAllString(text, "")
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Check compares the page with its last version, and stores the page
+// as the last version. Pages are identified by their URL, and the
+// Watcher Selector.
+func (w *Watcher) Check(page *Page) (*Changes, error) {
+	cur, err := w.Snapshot(page)
+	if err != nil {
+		return nil, err
+	}
+	key := "watch " + w.Selector + " " + cur.URL
+	changes := &Changes{Current: cur}
+	b, err := w.Store.Get(key)
+	switch {
+	case err == ErrCacheMiss:
+	case err != nil:
+		return nil, err
+	default:
+		prev := new(Snapshot)
+		if err := json.Unmarshal(b, prev); err != nil {
+			page.log().Warn("invalid watch snapshot, ignoring", "url", cur.URL, "err", err)
+			break
+		}
+		changes.Previous = prev
+		if prev.Fingerprint != cur.Fingerprint {
+			changes.Text = diffLines(prev.Text, cur.Text)
+			changes.Cells, changes.Rows = diffTables(prev.Tables, cur.Tables)
+		}
+	}
+	if b, err = json.Marshal(cur); err != nil {
+		return nil, err
+	}
+	if err := w.Store.Set(key, b); err != nil {
+		return nil, err
+	}
+	if changes.Changed() {
+		page.log().Info("page changed", "url", cur.URL, "lines", len(changes.Text), "cells", len(changes.Cells), "rows", len(changes.Rows))
+	}
+	return changes, nil
+}
+
+// blockElements break the text in lines.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"fieldset": true, "figcaption": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "header": true, "hr": true, "li": true,
+	"main": true, "nav": true, "ol": true, "option": true, "p": true,
+	"pre": true, "section": true, "table": true, "td": true, "th": true,
+	"tr": true, "ul": true,
+}
+
+// diffLines returns the lines removed from a and added in b.
+func diffLines(a, b []string) []TextChange {
+	var changes []TextChange
+	for _, e := range diffEdits(a, b) {
+		switch e.op {
+		case DiffRemoved:
+			changes = append(changes, TextChange{Op: DiffRemoved, Text: a[e.i]})
+		case DiffAdded:
+			changes = append(changes, TextChange{Op: DiffAdded, Text: b[e.j]})
+		}
+	}
+	return changes
+}
+
+// edit is a step to change a into b: the line a[i] kept as b[j],
+// the line a[i] removed, or the line b[j] added.
+type edit struct {
+	op   DiffOp // Zero when the line is kept.
+	i, j int
+}
+
+// diffEdits returns the steps to change a into b, keeping the longest
+// common subsequence.
+func diffEdits(a, b []string) []edit {
+	var edits []edit
+	// Keep the common prefix and suffix.
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		edits = append(edits, edit{i: start, j: start})
+		start++
+	}
+	endA, endB := len(a), len(b)
+	for endA > start && endB > start && a[endA-1] == b[endB-1] {
+		endA--
+		endB--
+	}
+	suffix := func() []edit {
+		for k := 0; endA+k < len(a); k++ {
+			edits = append(edits, edit{i: endA + k, j: endB + k})
+		}
+		return edits
+	}
+	n, m := endA-start, endB-start
+
+	if n*m > maxDiffLines {
+		for i := start; i < endA; i++ {
+			edits = append(edits, edit{op: DiffRemoved, i: i})
+		}
+		for j := start; j < endB; j++ {
+			edits = append(edits, edit{op: DiffAdded, j: j})
+		}
+		return suffix()
+	}
+	// lcs[i][j] is the length of the LCS of a[start+i:endA] and b[start+j:endB].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[start+i] == b[start+j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[start+i] == b[start+j]:
+			edits = append(edits, edit{i: start + i, j: start + j})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{op: DiffRemoved, i: start + i})
+			i++
+		default:
+			edits = append(edits, edit{op: DiffAdded, j: start + j})
+			j++
+		}
+	}
+	return suffix()
+}
+
+// diffTables returns the cells that differ between the tables a and b,
+// and the rows added or removed. Rows are aligned by their text, as
+// lines are, and a removed row is paired with an added row, as a changed
+// row, when at least half of their cells are equal. The headers of the
+// tables in b describe the columns.
+func diffTables(a, b []Table) ([]CellChange, []RowChange) {
+	var (
+		cells []CellChange
+		rows  []RowChange
+	)
+	for t := 0; t < len(a) || t < len(b); t++ {
+		var ta, tb Table
+		if t < len(a) {
+			ta = a[t]
+		}
+		if t < len(b) {
+			tb = b[t]
+		}
+		// removed and added are the rows between two rows kept.
+		var removed, added []int
+		flush := func() {
+			next := 0
+			for _, r := range removed {
+				paired := false
+				for k := next; k < len(added); k++ {
+					if !similarRows(ta.Data[r], tb.Data[added[k]]) {
+						continue
+					}
+					for _, ar := range added[next:k] {
+						rows = append(rows, RowChange{Op: DiffAdded, Table: t, Row: ar, Cells: tb.Data[ar]})
+					}
+					cells = append(cells, diffCells(t, ta, tb, ta.Data[r], added[k])...)
+					next, paired = k+1, true
+					break
+				}
+				if !paired {
+					rows = append(rows, RowChange{Op: DiffRemoved, Table: t, Row: r, Cells: ta.Data[r]})
+				}
+			}
+			for _, ar := range added[next:] {
+				rows = append(rows, RowChange{Op: DiffAdded, Table: t, Row: ar, Cells: tb.Data[ar]})
+			}
+			removed, added = removed[:0], added[:0]
+		}
+		for _, e := range diffEdits(rowKeys(ta.Data), rowKeys(tb.Data)) {
+			switch e.op {
+			case DiffRemoved:
+				removed = append(removed, e.i)
+			case DiffAdded:
+				added = append(added, e.j)
+			default:
+				flush()
+			}
+		}
+		flush()
+	}
+	return cells, rows
+}
+
+// diffCells returns the cells that differ between the row old of the
+// table ta and the row r of the table tb.
+func diffCells(t int, ta, tb Table, old []string, r int) []CellChange {
+	var changes []CellChange
+	cur := tb.Data[r]
+	for c := 0; c < len(old) || c < len(cur); c++ {
+		var o, n string
+		if c < len(old) {
+			o = old[c]
+		}
+		if c < len(cur) {
+			n = cur[c]
+		}
+		if o == n {
+			continue
+		}
+		change := CellChange{Table: t, Row: r, Col: c, Old: o, New: n}
+		if c < len(tb.Header) {
+			change.Header = tb.Header[c]
+		} else if c < len(ta.Header) {
+			change.Header = ta.Header[c]
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// rowKeys returns the text of each row, to compare them as lines.
+func rowKeys(rows [][]string) []string {
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		keys[i] = strings.Join(row, "\x1f")
+	}
+	return keys
+}
+
+// similarRows reports whether at least half of the cells of the rows
+// a and b are equal, so they are the same row with changes.
+func similarRows(a, b []string) bool {
+	equal := 0
+	for c := 0; c < len(a) && c < len(b); c++ {
+		if a[c] == b[c] {
+			equal++
+		}
+	}
+	return equal > 0 && 2*equal >= max(len(a), len(b))
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 Ronoaldo JLP <ronoaldo@gmail.com>
+// Licensed under the Apache License, Version 2.0
+
+package bot
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+
+	"ronoaldo.gopkg.net/bot/bottest"
+)
+
+func TestWatcher(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		status = "Open"
+		price  = "10"
+		now    = "10:00:00"
+		extra  = ""
+	)
+	s := bottest.NewSite().HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, `<html><body>
+			<p>Updated at %s <span class="ad">Buy now!</span></p>
+			<div id="status">Store is <b>%s</b></div>%s
+			%s
+			<script>var x = 1;</script>
+		</body></html>`, now, status, extra,
+			bottest.RenderTable([]string{"Item", "Price"}, []string{"A", "5"}, []string{"B", price}))
+	})
+	defer s.Close()
+
+	set := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	b := New().BaseURL(s.URL)
+	w := NewWatcher(NewMemoryCache())
+	w.Ignore = []string{".ad"}
+	w.IgnorePatterns = []*regexp.Regexp{regexp.MustCompile(`\d\d:\d\d:\d\d`)}
+	sw := NewWatcher(w.Store)
+	sw.Selector = "#status"
+	check := func(w *Watcher) *Changes {
+		t.Helper()
+		page, err := b.GET("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes, err := w.Check(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changes
+	}
+
+	if c := check(w); c.Changed() || c.Previous != nil {
+		t.Errorf("Expected no previous version, got %+v", c)
+	}
+	if c := check(sw); c.Changed() || c.Previous != nil {
+		t.Errorf("Expected no previous version of the status, got %+v", c)
+	}
+	want := []string{"Updated at", "Store is Open", "Item", "Price", "A", "5", "B", "10"}
+	if c := check(w); !reflect.DeepEqual(c.Current.Text, want) {
+		t.Errorf("Unexpected text:\n%q, want\n%q", c.Current.Text, want)
+	}
+
+	// Volatile content is ignored.
+	set(func() { now = "11:30:00" })
+	if c := check(w); c.Changed() {
+		t.Errorf("Expected no changes, got %+v", c)
+	}
+
+	set(func() { price, extra = "12", "<p>Sale!</p>" })
+	c := check(w)
+	if !c.Changed() {
+		t.Fatalf("Expected changes")
+	}
+	wantText := []TextChange{{DiffAdded, "Sale!"}, {DiffRemoved, "10"}, {DiffAdded, "12"}}
+	if !reflect.DeepEqual(c.Text, wantText) {
+		t.Errorf("Unexpected text changes:\n%v, want\n%v", c.Text, wantText)
+	}
+	wantCells := []CellChange{{Table: 0, Row: 1, Col: 1, Header: "Price", Old: "10", New: "12"}}
+	if !reflect.DeepEqual(c.Cells, wantCells) {
+		t.Errorf("Unexpected cell changes:\n%+v, want\n%+v", c.Cells, wantCells)
+	}
+	if c := check(sw); c.Changed() {
+		t.Errorf("Expected no changes in the status, got %+v", c)
+	}
+
+	set(func() { status = "Closed" })
+	c = check(sw)
+	wantText = []TextChange{{DiffRemoved, "Store is Open"}, {DiffAdded, "Store is Closed"}}
+	if !c.Changed() || !reflect.DeepEqual(c.Text, wantText) || len(c.Cells) != 0 {
+		t.Errorf("Unexpected status changes: %+v", c)
+	}
+}
+
+func TestWatcherSelectorNotFound(t *testing.T) {
+	s := bottest.NewSite().Page("/", `<html><body><p id="other">Hello</p></body></html>`)
+	defer s.Close()
+	page, err := New().BaseURL(s.URL).GET("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(NewMemoryCache())
+	w.Selector = "#status"
+	if _, err := w.Check(page); err == nil {
+		t.Errorf("Expected an error when the selector matches nothing")
+	}
+}
+
+func TestDiffTables(t *testing.T) {
+	header := []string{"Item", "Price"}
+	prev := []Table{{Header: header, Data: [][]string{{"A", "5"}, {"B", "10"}, {"C", "7"}, {"D", "1"}}}}
+	cur := []Table{{Header: header, Data: [][]string{{"N", "3"}, {"A", "5"}, {"B", "12"}, {"D", "1"}}}}
+	cells, rows := diffTables(prev, cur)
+	wantCells := []CellChange{{Table: 0, Row: 2, Col: 1, Header: "Price", Old: "10", New: "12"}}
+	if !reflect.DeepEqual(cells, wantCells) {
+		t.Errorf("Unexpected cell changes:\n%+v, want\n%+v", cells, wantCells)
+	}
+	wantRows := []RowChange{
+		{Op: DiffAdded, Table: 0, Row: 0, Cells: []string{"N", "3"}},
+		{Op: DiffRemoved, Table: 0, Row: 2, Cells: []string{"C", "7"}},
+	}
+	if !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("Unexpected row changes:\n%+v, want\n%+v", rows, wantRows)
+	}
+}